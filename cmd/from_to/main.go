@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/gustapinto/from-to/internal/config"
 	"github.com/gustapinto/from-to/internal/event"
@@ -12,19 +16,29 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && isMaintenanceCommand(os.Args[1]) {
+		if err := runMaintenance(os.Args[1], os.Args[2:]); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	configPath := flag.String("manifest", "from_to.yaml", "The configuration manifest file path")
 	logFormat := flag.String("logFormat", "text", "The logging format, one of [text, json]")
 	noColor := flag.Bool("noColor", false, "Use to disable colored logging, only valid for text logFormat")
 	isDebug := flag.Bool("debug", false, "Use to enable debug level logging")
+	snapshot := flag.String("snapshot", "", "Comma separated list of tables to snapshot again, even if they were already snapshotted")
 	flag.Parse()
 
-	if err := run(*configPath, *logFormat, *noColor, *isDebug); err != nil {
+	if err := run(*configPath, *logFormat, *noColor, *isDebug, *snapshot); err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
-func run(configPath, logFormat string, noColor, isDebug bool) error {
+func run(configPath, logFormat string, noColor, isDebug bool, snapshot string) error {
 	if err := logging.SetupSlog(isDebug, noColor, logFormat); err != nil {
 		return err
 	}
@@ -36,6 +50,12 @@ func run(configPath, logFormat string, noColor, isDebug bool) error {
 
 	slog.Info("Loaded application config from file", "configPath", configPath)
 
+	if snapshot != "" {
+		if err := config.SetForcedSnapshotTables(cfg, strings.Split(snapshot, ",")); err != nil {
+			return err
+		}
+	}
+
 	listener, err := config.GetListener(*cfg)
 	if err != nil {
 		return fmt.Errorf("Failed to setup output connector from config, got error %s", err.Error())
@@ -56,13 +76,28 @@ func run(configPath, logFormat string, noColor, isDebug bool) error {
 		return fmt.Errorf("Failed to setup channels from config, got error %s", err.Error())
 	}
 
-	processor := event.NewProcessor(listener, publishers, mappers, channels)
+	processor := event.NewProcessor(
+		listener,
+		publishers,
+		mappers,
+		channels,
+		cfg.DrainTimeoutSecondsOrDefault())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	slog.Info("Application started, listening for new rows to process")
 
-	if err := processor.ListenAndProcess(); err != nil {
-		return fmt.Errorf("Failed to listen and process, got error %s", err.Error())
+	listenErr := processor.ListenAndProcess(ctx)
+	if err := processor.Close(); err != nil {
+		slog.Error("Failed to close connectors", "error", err.Error())
+	}
+
+	if listenErr != nil {
+		return fmt.Errorf("Failed to listen and process, got error %s", listenErr.Error())
 	}
 
+	slog.Info("Application stopped")
+
 	return nil
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/gustapinto/from-to/internal/config"
+	"github.com/gustapinto/from-to/internal/logging"
+)
+
+const (
+	_commandUninstall    = "uninstall"
+	_commandSyncTriggers = "sync-triggers"
+)
+
+func isMaintenanceCommand(command string) bool {
+	return command == _commandUninstall || command == _commandSyncTriggers
+}
+
+// Runs a command that changes the objects installed on the input database
+// instead of processing events, with --dry-run the SQL is only printed
+func runMaintenance(command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := flags.String("manifest", "from_to.yaml", "The configuration manifest file path")
+	logFormat := flags.String("logFormat", "text", "The logging format, one of [text, json]")
+	noColor := flags.Bool("noColor", false, "Use to disable colored logging, only valid for text logFormat")
+	isDebug := flags.Bool("debug", false, "Use to enable debug level logging")
+	dryRun := flags.Bool("dry-run", false, "Print the SQL statements instead of executing them")
+
+	var dropEventTable *bool
+	if command == _commandUninstall {
+		dropEventTable = flags.Bool("drop-event-table", false, "Also drop the event table and its companion tables")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := logging.SetupSlog(*isDebug, *noColor, *logFormat); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfigFromYamlFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to load config file, got error %s", err.Error())
+	}
+
+	maintenance, err := config.GetMaintenance(*cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to input database, got error %s", err.Error())
+	}
+	defer maintenance.Close()
+
+	ctx := context.Background()
+
+	var statements []string
+	if command == _commandUninstall {
+		statements, err = maintenance.UninstallStatements(ctx, *dropEventTable)
+	} else {
+		statements, err = maintenance.SyncTriggersStatements(ctx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to plan %s, got error %s", command, err.Error())
+	}
+
+	if len(statements) == 0 {
+		slog.Info("Nothing to change")
+		return nil
+	}
+
+	if *dryRun {
+		for _, statement := range statements {
+			fmt.Println(statement + ";")
+		}
+
+		return nil
+	}
+
+	if err := maintenance.Apply(ctx, statements); err != nil {
+		return fmt.Errorf("Failed to apply %s, got error %s", command, err.Error())
+	}
+
+	slog.Info("Database changes applied", "command", command, "statements", len(statements))
+
+	return nil
+}
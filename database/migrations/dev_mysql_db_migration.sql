@@ -0,0 +1,10 @@
+-- Only needed by the mysqlBinlog input, run as root:
+-- GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO 'from-to-user'@'%';
+
+CREATE TABLE IF NOT EXISTS `sales` (
+    `id` CHAR(36) PRIMARY KEY DEFAULT (UUID()),
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP NULL,
+    `description` VARCHAR(255) NOT NULL,
+    `total_value` DECIMAL(10, 2) NOT NULL
+);
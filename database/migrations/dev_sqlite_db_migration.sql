@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS "sales" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "created_at" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TEXT NULL,
+    "description" TEXT NOT NULL,
+    "total_value" NUMERIC NOT NULL
+);
@@ -3,13 +3,24 @@ function map_sales_event(event)
         ['I'] = 'INSERT',
         ['U'] = 'UPGRADE',
         ['D'] = 'DELETE',
+        ['R'] = 'READ',
+        ['T'] = 'TRUNCATE',
     }
 
+    -- Truncate events do not carry a row, they mean the whole table was cleared
+    if event['op'] == 'T' then
+        return {
+            ['action'] = op_mapping[event['op']],
+            ['index'] = event['table'],
+        }
+    end
+
+    -- The second value is the record key, used by channels with the "mapper" record key strategy
     return {
         ['action'] = op_mapping[event['op']],
         ['index'] = event['table'] .. '/' .. event['row']['id'],
         ['data'] = event['row'],
-    }
+    }, tostring(event['row']['id'])
 end
 
 function map_sales_event_with_http(event)
@@ -20,6 +31,8 @@ function map_sales_event_with_http(event)
         ['I'] = 'INSERT',
         ['U'] = 'UPGRADE',
         ['D'] = 'DELETE',
+        ['R'] = 'READ',
+        ['T'] = 'TRUNCATE',
     }
 
     local res, err = http.get('https://jsonplaceholder.typicode.com/users', {
@@ -30,9 +43,15 @@ function map_sales_event_with_http(event)
 
     local users = json.decode(res.body)
 
+    -- Truncate events do not carry a row
+    local index = event['table']
+    if event['row'] ~= nil then
+        index = index .. '/' .. event['row']['id']
+    end
+
     return {
         ['action'] = op_mapping[event['op']],
-        ['index'] = event['table'] .. '/' .. event['row']['id'],
+        ['index'] = index,
         ['data'] = event['row'],
         ['user_id'] = users[1]['id'],
         ['user_name'] = users[1]['name'],
@@ -2,12 +2,17 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gustapinto/from-to/internal/connectors/kafka"
+	"github.com/gustapinto/from-to/internal/connectors/mysql"
+	"github.com/gustapinto/from-to/internal/connectors/outbox"
 	"github.com/gustapinto/from-to/internal/connectors/postgres"
+	"github.com/gustapinto/from-to/internal/connectors/sqlite"
 	"github.com/gustapinto/from-to/internal/connectors/webhook"
 	"github.com/gustapinto/from-to/internal/event"
 	"github.com/gustapinto/from-to/internal/mappers/lua"
@@ -15,10 +20,15 @@ import (
 )
 
 const (
-	_typePostgres = "postgres"
-	_typeKafka    = "kafka"
-	_typeLua      = "lua"
-	_typeWebhook  = "webhook"
+	_typePostgres            = "postgres"
+	_typePostgresReplication = "postgresReplication"
+	_typeMySQL               = "mysql"
+	_typeMySQLBinlog         = "mysqlBinlog"
+	_typeSQLite              = "sqlite"
+	_typeOutbox              = "outbox"
+	_typeKafka               = "kafka"
+	_typeLua                 = "lua"
+	_typeWebhook             = "webhook"
 )
 
 type Manifest struct {
@@ -27,15 +37,28 @@ type Manifest struct {
 }
 
 type Config struct {
-	Input    Input                    `yaml:"input"`
-	Outputs  map[string]Output        `yaml:"outputs"`
-	Mappers  map[string]Mapper        `yaml:"mappers"`
-	Channels map[string]event.Channel `yaml:"channels"`
+	Input               Input                    `yaml:"input"`
+	Outputs             map[string]Output        `yaml:"outputs"`
+	Mappers             map[string]Mapper        `yaml:"mappers"`
+	Channels            map[string]event.Channel `yaml:"channels"`
+	DrainTimeoutSeconds uint64                   `yaml:"drainTimeoutSeconds"`
+}
+
+func (c *Config) DrainTimeoutSecondsOrDefault() time.Duration {
+	if c.DrainTimeoutSeconds == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(c.DrainTimeoutSeconds) * time.Second
 }
 
 type Input struct {
-	Connector      string          `yaml:"connector"`
-	PostgresConfig postgres.Config `yaml:"postgresConfig"`
+	Connector      string               `yaml:"connector"`
+	PostgresConfig postgres.Config      `yaml:"postgresConfig"`
+	MySQLConfig    mysql.Config         `yaml:"mysqlConfig"`
+	SQLiteConfig   sqlite.Config        `yaml:"sqliteConfig"`
+	OutboxConfig   outbox.Config        `yaml:"outboxConfig"`
+	KafkaConfig    kafka.ConsumerConfig `yaml:"kafkaConfig"`
 }
 
 type Output struct {
@@ -59,19 +82,78 @@ func LoadConfigFromYamlFile(configPath string) (*Config, error) {
 		for key, channel := range config.Channels {
 			channel.Key = key
 			config.Channels[key] = channel
+
+			if err := channel.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid channel [%s], got error %s", key, err.Error())
+			}
 		}
 	}
 
+	applyWebhookRetries(config)
+
 	return config, nil
 }
 
+// Webhooks used to retry failed requests on their own, 3 times by default.
+// Channels publishing to a webhook keep those retries through the channel
+// retry policy, unless they set their own max attempts
+func applyWebhookRetries(config *Config) {
+	for key, channel := range config.Channels {
+		output, exists := config.Outputs[channel.To]
+		if !exists || output.Connector != _typeWebhook || channel.Retry.MaxAttempts != 0 {
+			continue
+		}
+
+		channel.Retry.MaxAttempts = output.WebHookConfig.RetriesOrDefault() + 1
+		config.Channels[key] = channel
+	}
+}
+
 func GetListener(config Config) (event.Listener, error) {
 	switch config.Input.Connector {
 	case _typePostgres:
 		return postgres.NewListener(config.Input.PostgresConfig, config.Channels)
+
+	case _typePostgresReplication:
+		return postgres.NewReplicationListener(config.Input.PostgresConfig, config.Channels)
+
+	case _typeMySQL:
+		return mysql.NewListener(config.Input.MySQLConfig, config.Channels)
+
+	case _typeMySQLBinlog:
+		return mysql.NewBinlogListener(config.Input.MySQLConfig, config.Channels)
+
+	case _typeSQLite:
+		return sqlite.NewListener(config.Input.SQLiteConfig, config.Channels)
+
+	case _typeOutbox:
+		return outbox.NewListener(config.Input.OutboxConfig, config.Channels)
+
+	case _typeKafka:
+		return kafka.NewListener(config.Input.KafkaConfig, config.Channels)
 	}
 
-	return nil, errors.New("invalid config type, expected one of: [postgres]")
+	return nil, errors.New("invalid config type, expected one of: [postgres, postgresReplication, mysql, mysqlBinlog, sqlite, outbox, kafka]")
+}
+
+func GetMaintenance(config Config) (*postgres.Maintenance, error) {
+	if config.Input.Connector != _typePostgres {
+		return nil, errors.New("invalid config type, triggers are only installed by the postgres connector")
+	}
+
+	return postgres.NewMaintenance(config.Input.PostgresConfig)
+}
+
+// Snapshots are only taken by the postgres connector, so the flag is rejected
+// instead of being ignored by the other ones
+func SetForcedSnapshotTables(config *Config, tables []string) error {
+	if config.Input.Connector != _typePostgres {
+		return fmt.Errorf("invalid config type [%s], snapshots are only supported by the postgres connector", config.Input.Connector)
+	}
+
+	config.Input.PostgresConfig.ForcedSnapshotTables = tables
+
+	return nil
 }
 
 func GetMappers(config Config) (mappers map[string]event.Mapper, err error) {
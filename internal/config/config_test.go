@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/gustapinto/from-to/internal/connectors/webhook"
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+func TestApplyWebhookRetries(t *testing.T) {
+	retries := uint64(0)
+	config := &Config{
+		Outputs: map[string]Output{
+			"hook":        {Connector: _typeWebhook},
+			"noRetryHook": {Connector: _typeWebhook, WebHookConfig: webhook.Config{Retries: &retries}},
+			"kafka":       {Connector: _typeKafka},
+		},
+		Channels: map[string]event.Channel{
+			"default":  {To: "hook"},
+			"noRetry":  {To: "noRetryHook"},
+			"explicit": {To: "hook", Retry: event.RetryConfig{MaxAttempts: 2}},
+			"kafka":    {To: "kafka"},
+		},
+	}
+
+	applyWebhookRetries(config)
+
+	expected := map[string]uint64{"default": 4, "noRetry": 1, "explicit": 2, "kafka": 0}
+	for key, maxAttempts := range expected {
+		if config.Channels[key].Retry.MaxAttempts != maxAttempts {
+			t.Errorf("channel %s: expected %d max attempts, got %d", key, maxAttempts, config.Channels[key].Retry.MaxAttempts)
+		}
+	}
+}
+
+func TestSetForcedSnapshotTables(t *testing.T) {
+	config := &Config{Input: Input{Connector: _typePostgres}}
+	if err := SetForcedSnapshotTables(config, []string{"sales"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Input.PostgresConfig.ForcedSnapshotTables) != 1 {
+		t.Errorf("expected the forced snapshot tables to be set, got %v", config.Input.PostgresConfig.ForcedSnapshotTables)
+	}
+
+	for _, connector := range []string{_typePostgresReplication, _typeMySQL, _typeMySQLBinlog, _typeSQLite, _typeOutbox, _typeKafka} {
+		config := &Config{Input: Input{Connector: connector}}
+		if err := SetForcedSnapshotTables(config, []string{"sales"}); err == nil {
+			t.Errorf("expected an error forcing a snapshot on the %s connector", connector)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package eventtable
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+// Inserts the dead letter with the connector insert query, which takes the
+// event id, channel, event, payload, error and attempts. The event is sent as
+// text, so it is stored as such by SQLite instead of as a blob
+func WriteDeadLetter(
+	ctx context.Context,
+	db *sql.DB,
+	query string,
+	timeout time.Duration,
+	deadLetter event.DeadLetter,
+) error {
+	eventData, err := json.Marshal(deadLetter.Event)
+	if err != nil {
+		return err
+	}
+
+	var payload sql.NullString
+	if deadLetter.Payload != "" {
+		payload = sql.NullString{String: deadLetter.Payload, Valid: true}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = db.ExecContext(
+		ctx,
+		query,
+		deadLetter.Event.ID,
+		deadLetter.Channel,
+		string(eventData),
+		payload,
+		deadLetter.Error,
+		deadLetter.Attempts)
+
+	return err
+}
@@ -0,0 +1,210 @@
+package eventtable
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+// Records on the input database which channels acknowledged each event of an
+// event table, so an event that failed on some channel is only published again
+// to the channels that did not acknowledge it on the next poll
+type Ledger struct {
+	DB      *sql.DB
+	Timeout time.Duration
+	Logger  *slog.Logger
+
+	// Build the query and arguments for a list of event ids. The delivered
+	// channels query returns the event id and channel of the delivered ones
+	DeliveredChannelsQuery func(ids []uint64) (string, []any)
+	SetEventsAsSentQuery   func(ids []uint64) (string, []any)
+
+	// Takes the event id, channel, status, attempts and last error
+	SaveDeliveryQuery string
+}
+
+// Publishes the events of a batch in order and marks the ones acknowledged by
+// every channel as sent. Returns false if some event is still pending
+func (l Ledger) PublishBatch(
+	ctx context.Context,
+	events []event.Event,
+	tableToChannelRelation map[string][]event.Channel,
+	callback event.Callback,
+) (bool, error) {
+	deliveredChannels, err := l.getDeliveredChannels(ctx, events)
+	if err != nil {
+		return false, err
+	}
+
+	allDone := true
+	sentIDs := make([]uint64, 0, len(events))
+	for _, e := range events {
+		done, publishErr := l.publishEvent(ctx, e, tableToChannelRelation, deliveredChannels[e.ID], callback)
+		if publishErr != nil {
+			err = publishErr
+			break
+		}
+
+		if !done {
+			allDone = false
+			continue
+		}
+
+		sentIDs = append(sentIDs, e.ID)
+	}
+
+	// Events published before a failure are still marked as sent, so they are
+	// not published again on the next poll
+	if sentErr := l.setEventsAsSent(ctx, sentIDs); sentErr != nil {
+		return false, errors.Join(err, sentErr)
+	}
+
+	return allDone, err
+}
+
+func (l Ledger) publishEvent(
+	ctx context.Context,
+	e event.Event,
+	tableToChannelRelation map[string][]event.Channel,
+	delivered map[string]bool,
+	callback event.Callback,
+) (bool, error) {
+	deliveries, err := event.PublishPending(e, tableToChannelRelation, delivered, callback, l.Logger)
+	if err != nil {
+		return false, err
+	}
+
+	if len(deliveries) == 0 {
+		return true, nil
+	}
+
+	if err := l.saveDeliveries(ctx, e, deliveries); err != nil {
+		return false, err
+	}
+
+	for _, delivery := range deliveries {
+		if !delivery.Done() {
+			l.Logger.Warn(
+				"Event was not acknowledged by every channel, it will be retried",
+				"event", e.ID,
+				"channel", delivery.Channel.Key,
+			)
+
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (l Ledger) getDeliveredChannels(ctx context.Context, events []event.Event) (map[uint64]map[string]bool, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	query, args := l.DeliveredChannelsQuery(ids)
+	rows, err := l.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveredChannels := make(map[uint64]map[string]bool)
+	for rows.Next() {
+		var eventID uint64
+		var channel string
+		if err := rows.Scan(&eventID, &channel); err != nil {
+			return nil, err
+		}
+
+		if deliveredChannels[eventID] == nil {
+			deliveredChannels[eventID] = make(map[string]bool)
+		}
+
+		deliveredChannels[eventID][channel] = true
+	}
+
+	return deliveredChannels, rows.Err()
+}
+
+func (l Ledger) saveDeliveries(ctx context.Context, e event.Event, deliveries []event.Delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		var lastError sql.NullString
+		if delivery.Err != nil {
+			lastError = sql.NullString{String: delivery.Err.Error(), Valid: true}
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			l.SaveDeliveryQuery,
+			e.ID,
+			delivery.Channel.Key,
+			delivery.Status,
+			delivery.Attempts,
+			lastError)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	l.Logger.Debug("Saved event deliveries", "event", e, "deliveries", deliveries)
+
+	return nil
+}
+
+func (l Ledger) setEventsAsSent(ctx context.Context, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	query, args := l.SetEventsAsSentQuery(ids)
+	if _, err := l.DB.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	l.Logger.Debug("Marked events as sent", "events", len(ids))
+
+	return nil
+}
+
+// Formats a query that takes an IN list of ids, for drivers with "?"
+// placeholders
+func IDListQuery(partialQuery string, ids []uint64) (string, []any) {
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	return fmt.Sprintf(partialQuery, placeholders), args
+}
@@ -0,0 +1,17 @@
+package eventtable
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIDListQuery(t *testing.T) {
+	query, args := IDListQuery("SELECT 1 WHERE id IN (%s)", []uint64{1, 2, 3})
+	if query != "SELECT 1 WHERE id IN (?, ?, ?)" {
+		t.Errorf("unexpected query %s", query)
+	}
+
+	if !reflect.DeepEqual(args, []any{uint64(1), uint64(2), uint64(3)}) {
+		t.Errorf("unexpected args %v", args)
+	}
+}
@@ -1,5 +1,12 @@
 package kafka
 
+import "time"
+
+const (
+	StartOffsetEarliest = "earliest"
+	StartOffsetLatest   = "latest"
+)
+
 type TopicConfig struct {
 	Name              string `yaml:"name"`
 	Partitions        int32  `yaml:"partitions"`
@@ -26,3 +33,47 @@ type Config struct {
 	BootstrapServers []string    `yaml:"bootstrapServers"`
 	Topic            TopicConfig `yaml:"topic"`
 }
+
+// Configuration of the kafka input, which consumes topics with a consumer
+// group instead of publishing to one
+type ConsumerConfig struct {
+	BootstrapServers []string `yaml:"bootstrapServers"`
+	Topics           []string `yaml:"topics"`
+	GroupID          string   `yaml:"groupId"`
+	StartOffset      string   `yaml:"startOffset"`
+	PollLimit        int      `yaml:"pollLimit"`
+	RetrySeconds     uint64   `yaml:"retrySeconds"`
+}
+
+func (cc *ConsumerConfig) GroupIDOrDefault() string {
+	if cc.GroupID == "" {
+		return "from-to"
+	}
+
+	return cc.GroupID
+}
+
+// Only used when the group has no committed offset for a partition
+func (cc *ConsumerConfig) StartOffsetOrDefault() string {
+	if cc.StartOffset == "" {
+		return StartOffsetEarliest
+	}
+
+	return cc.StartOffset
+}
+
+func (cc *ConsumerConfig) PollLimitOrDefault() int {
+	if cc.PollLimit <= 0 {
+		return 100
+	}
+
+	return cc.PollLimit
+}
+
+func (cc *ConsumerConfig) RetrySecondsOrDefault() time.Duration {
+	if cc.RetrySeconds == 0 {
+		return 5 * time.Second
+	}
+
+	return time.Duration(cc.RetrySeconds) * time.Second
+}
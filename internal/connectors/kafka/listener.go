@@ -0,0 +1,388 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Event ids pack the index of the topic on the configuration, the partition
+// and the offset of the record, so they are unique across every consumed
+// partition
+const (
+	_idTopicBits     = 6
+	_idPartitionBits = 14
+	_idOffsetBits    = 44
+)
+
+var errPartitionRevoked = errors.New("partition was revoked")
+
+// Consumes topics with a consumer group, turning each record into an event of
+// a table named after its topic. Offsets are only committed after every
+// channel routed to the record has acknowledged, so a restart consumes again
+// any record that was not processed
+type Listener struct {
+	client                 *kgo.Client
+	pollLimit              int
+	retrier                event.Retrier
+	logger                 *slog.Logger
+	tableToChannelRelation map[string][]event.Channel
+	topics                 map[string]uint64
+
+	// Guards the records published since the last commit and the partitions
+	// revoked since the last poll, which rebalance callbacks also change
+	mu        sync.Mutex
+	processed []*kgo.Record
+	revoked   map[string]map[int32]bool
+}
+
+func NewListener(config ConsumerConfig, channels map[string]event.Channel) (*Listener, error) {
+	listener := &Listener{
+		pollLimit: config.PollLimitOrDefault(),
+		logger:    slog.With("listener", "Kafka"),
+		topics:    make(map[string]uint64, len(config.Topics)),
+		revoked:   make(map[string]map[int32]bool),
+	}
+
+	listener.retrier = event.Retrier{
+		Interval: config.RetrySecondsOrDefault(),
+		Logger:   listener.logger,
+	}
+
+	if len(config.Topics) == 0 {
+		return nil, errors.New("the kafka input requires at least one topic")
+	}
+
+	if len(config.Topics) > 1<<_idTopicBits {
+		return nil, fmt.Errorf("the kafka input supports at most %d topics", 1<<_idTopicBits)
+	}
+
+	for i, topic := range config.Topics {
+		listener.topics[topic] = uint64(i)
+	}
+
+	startOffset := kgo.NewOffset().AtStart()
+	switch config.StartOffsetOrDefault() {
+	case StartOffsetEarliest:
+	case StartOffsetLatest:
+		startOffset = kgo.NewOffset().AtEnd()
+	default:
+		return nil, fmt.Errorf(
+			"invalid start offset [%s], expected one of: [%s, %s]",
+			config.StartOffset,
+			StartOffsetEarliest,
+			StartOffsetLatest)
+	}
+
+	if event.UsesDeadLetterTable(channels) {
+		return nil, errors.New("dead letter tables are not supported by the kafka input, use deadLetter.to instead")
+	}
+
+	if event.UsesTransactionMarkers(channels) {
+		listener.logger.Warn("Transaction markers are not supported by the kafka input, ignoring")
+	}
+
+	// Rebalances are held while a batch is processed, so partitions are not
+	// reassigned before the offsets of their records are committed. They are
+	// only allowed early while a record waits to be retried
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(config.BootstrapServers...),
+		kgo.ConsumerGroup(config.GroupIDOrDefault()),
+		kgo.ConsumeTopics(config.Topics...),
+		kgo.ConsumeResetOffset(startOffset),
+		kgo.DisableAutoCommit(),
+		kgo.BlockRebalanceOnPoll(),
+		kgo.OnPartitionsRevoked(listener.onPartitionsRevoked),
+		kgo.OnPartitionsLost(listener.onPartitionsLost))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(context.Background()); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	listener.client = client
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
+	listener.logger.Info("Connector setup completed", "topics", config.Topics, "group", config.GroupIDOrDefault())
+
+	return listener, nil
+}
+
+// Consumes records until ctx is done. The records of a batch that already
+// started are published before stopping, unless a channel keeps failing
+func (l *Listener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	for {
+		fetches := l.client.PollRecords(ctx, l.pollLimit)
+		if ctx.Err() != nil || fetches.IsClientClosed() {
+			l.client.AllowRebalance()
+			l.logger.Info("Listener stopped")
+			return nil
+		}
+
+		err := l.processFetches(ctx, fetches, callback)
+		l.client.AllowRebalance()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				l.logger.Info("Listener stopped")
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// Leaves the consumer group, the offsets of processed records were already
+// committed
+func (l *Listener) Close() error {
+	l.client.Close()
+
+	l.logger.Debug("Client closed")
+
+	return nil
+}
+
+func (l *Listener) processFetches(
+	ctx context.Context,
+	fetches kgo.Fetches,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	for _, fetchErr := range fetches.Errors() {
+		if errors.Is(fetchErr.Err, context.Canceled) {
+			continue
+		}
+
+		return fmt.Errorf(
+			"Failed to fetch records of topic [%s] partition [%d], got error %s",
+			fetchErr.Topic,
+			fetchErr.Partition,
+			fetchErr.Err.Error())
+	}
+
+	records := fetches.Records()
+	if len(records) > 0 {
+		l.logger.Info(fmt.Sprintf("Processing %d records", len(records)))
+	}
+
+	// Rebalances are blocked since the poll, and the client does not return
+	// records of partitions revoked before it
+	l.mu.Lock()
+	clear(l.revoked)
+	l.mu.Unlock()
+
+	var err error
+	for _, record := range records {
+		if l.isRevoked(record) {
+			continue
+		}
+
+		e, eventErr := l.recordToEvent(record)
+		if eventErr != nil {
+			err = eventErr
+			break
+		}
+
+		err = l.publishEvent(ctx, record, e, callback)
+		if errors.Is(err, errPartitionRevoked) {
+			l.logger.Info("Partition was revoked while retrying, leaving the record to its new owner", "topic", record.Topic, "partition", record.Partition)
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			break
+		}
+
+		l.mu.Lock()
+		l.processed = append(l.processed, record)
+		l.mu.Unlock()
+	}
+
+	// Records published before a failure are still committed, so they are not
+	// consumed again after a restart
+	if commitErr := l.commitProcessed(ctx); commitErr != nil {
+		return errors.Join(err, commitErr)
+	}
+
+	return err
+}
+
+func (l *Listener) isRevoked(record *kgo.Record) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.revoked[record.Topic][record.Partition]
+}
+
+// Commits the records published so far before the partitions are handed to
+// another member, so it does not consume them again
+func (l *Listener) onPartitionsRevoked(ctx context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	l.mu.Lock()
+	l.markRevoked(revoked)
+	processed := l.takeProcessed()
+	l.mu.Unlock()
+
+	if err := l.commitRecords(ctx, processed); err != nil {
+		l.logger.Warn("Failed to commit offsets of revoked partitions, their records may be consumed again", "error", err.Error())
+	}
+}
+
+// Offsets of lost partitions can not be committed anymore, their records are
+// consumed again by the member that takes them
+func (l *Listener) onPartitionsLost(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.markRevoked(lost)
+
+	processed := l.processed[:0]
+	for _, record := range l.processed {
+		if !l.revoked[record.Topic][record.Partition] {
+			processed = append(processed, record)
+		}
+	}
+
+	l.processed = processed
+}
+
+func (l *Listener) markRevoked(partitions map[string][]int32) {
+	for topic, topicPartitions := range partitions {
+		if l.revoked[topic] == nil {
+			l.revoked[topic] = make(map[int32]bool)
+		}
+
+		for _, partition := range topicPartitions {
+			l.revoked[topic][partition] = true
+		}
+	}
+}
+
+// The lock is not held while committing, as commits wait for an ongoing
+// rebalance, which may be waiting for the revoke callback
+func (l *Listener) takeProcessed() []*kgo.Record {
+	processed := l.processed
+	l.processed = nil
+
+	return processed
+}
+
+func (l *Listener) commitProcessed(ctx context.Context) error {
+	l.mu.Lock()
+	processed := l.takeProcessed()
+	l.mu.Unlock()
+
+	err := l.commitRecords(context.WithoutCancel(ctx), processed)
+
+	// The group changed while committing, the records are consumed again by
+	// the members that own their partitions now
+	if errors.Is(err, kerr.RebalanceInProgress) || errors.Is(err, kerr.IllegalGeneration) || errors.Is(err, kerr.UnknownMemberID) {
+		l.logger.Warn("Failed to commit offsets during a rebalance, their records may be consumed again", "error", err.Error())
+		return nil
+	}
+
+	return err
+}
+
+func (l *Listener) commitRecords(ctx context.Context, records []*kgo.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := l.client.CommitRecords(ctx, records...); err != nil {
+		return fmt.Errorf("Failed to commit offsets, got error %w", err)
+	}
+
+	l.logger.Debug("Committed offsets", "records", len(records))
+
+	return nil
+}
+
+// JSON object values are used as the row, any other value is kept under the
+// "value" field
+func (l *Listener) recordToEvent(record *kgo.Record) (event.Event, error) {
+	if record.Partition >= 1<<_idPartitionBits || record.Offset >= 1<<_idOffsetBits {
+		return event.Event{}, fmt.Errorf(
+			"record of topic [%s] partition [%d] offset [%d] does not fit an event id",
+			record.Topic,
+			record.Partition,
+			record.Offset)
+	}
+
+	e := event.Event{
+		ID:        eventID(l.topics[record.Topic], record.Partition, record.Offset),
+		Ts:        uint64(record.Timestamp.Unix()),
+		Timestamp: record.Timestamp,
+		Op:        event.OpInsert,
+		Table:     record.Topic,
+	}
+
+	if record.Key != nil {
+		e.Key = map[string]any{"key": string(record.Key)}
+	}
+
+	if len(record.Headers) > 0 {
+		e.Headers = make(map[string]any, len(record.Headers))
+		for _, header := range record.Headers {
+			e.Headers[header.Key] = string(header.Value)
+		}
+	}
+
+	if record.Value == nil {
+		return e, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(record.Value, &value); err != nil {
+		value = string(record.Value)
+	}
+
+	if row, ok := value.(map[string]any); ok {
+		e.Row = row
+	} else {
+		e.Row = map[string]any{"value": value}
+	}
+
+	return e, nil
+}
+
+func eventID(topic uint64, partition int32, offset int64) uint64 {
+	return topic<<(_idPartitionBits+_idOffsetBits) | uint64(partition)<<_idOffsetBits | uint64(offset)
+}
+
+// The offset is not committed while the record is retried, so it is consumed
+// again if the application stops before every channel acknowledged it. The
+// group may rebalance while waiting to retry, so a failing channel does not
+// stall it, and the record is given up if its partition is revoked
+func (l *Listener) publishEvent(
+	ctx context.Context,
+	record *kgo.Record,
+	e event.Event,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	retrier := l.retrier
+	retrier.BeforeWait = func(context.Context) error {
+		l.client.AllowRebalance()
+
+		if l.isRevoked(record) {
+			return errPartitionRevoked
+		}
+
+		return nil
+	}
+
+	return retrier.Publish(ctx, e, l.tableToChannelRelation, callback)
+}
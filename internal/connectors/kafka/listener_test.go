@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestRecordToEventID(t *testing.T) {
+	l := &Listener{topics: map[string]uint64{"orders": 0, "payments": 1}}
+
+	records := []*kgo.Record{
+		{Topic: "orders", Partition: 0, Offset: 7},
+		{Topic: "orders", Partition: 1, Offset: 7},
+		{Topic: "payments", Partition: 0, Offset: 7},
+		{Topic: "payments", Partition: 1, Offset: 7},
+	}
+
+	ids := make(map[uint64]bool, len(records))
+	for _, record := range records {
+		e, err := l.recordToEvent(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids[e.ID] {
+			t.Errorf("records with the same offset should have distinct ids, got %d twice", e.ID)
+		}
+
+		ids[e.ID] = true
+	}
+
+	first, _ := l.recordToEvent(&kgo.Record{Topic: "orders", Partition: 3, Offset: 10})
+	second, _ := l.recordToEvent(&kgo.Record{Topic: "orders", Partition: 3, Offset: 11})
+	if first.ID >= second.ID {
+		t.Errorf("ids should increase with the offset of a partition, got %d and %d", first.ID, second.ID)
+	}
+
+	if _, err := l.recordToEvent(&kgo.Record{Topic: "orders", Partition: 1 << _idPartitionBits}); err == nil {
+		t.Error("a partition that does not fit the id should be rejected")
+	}
+}
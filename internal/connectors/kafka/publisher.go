@@ -2,13 +2,14 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"log/slog"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gustapinto/from-to/internal/event"
 	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
@@ -43,17 +44,23 @@ func NewPublisher(config Config) (c *Publisher, err error) {
 	return c, nil
 }
 
-func (c *Publisher) Publish(e event.Event, payload []byte) error {
+// A nil key lets the partitioner spread the records across partitions
+func (c *Publisher) Publish(ctx context.Context, e event.Event, key []byte, payload []byte) error {
 	record := kgo.Record{
-		Key:   []byte(strconv.Itoa(int(e.ID))),
+		Key:   key,
 		Value: payload,
 		Topic: c.topicName,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
 	if err := c.client.ProduceSync(ctx, &record).FirstErr(); err != nil {
+		var kafkaErr *kerr.Error
+		if errors.As(err, &kafkaErr) && !kafkaErr.Retriable {
+			return event.Permanent(err)
+		}
+
 		return err
 	}
 
@@ -67,6 +74,20 @@ func (c *Publisher) Publish(e event.Event, payload []byte) error {
 	return nil
 }
 
+// Flushes any buffered record and closes the client, also closing the admin
+// client that shares its connections
+func (c *Publisher) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := c.client.Flush(ctx)
+	c.client.Close()
+
+	c.logger.Debug("Client closed")
+
+	return err
+}
+
 func (c *Publisher) setupClient(bootstrapServers []string) (*kgo.Client, error) {
 	client, err := kgo.NewClient(kgo.SeedBrokers(bootstrapServers...))
 	if err != nil {
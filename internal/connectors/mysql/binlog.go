@@ -0,0 +1,763 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/gustapinto/from-to/internal/connectors/eventtable"
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+// Captures changes by reading the row based binlog as a replica, so the
+// tables do not need triggers. The position after the last published
+// transaction is saved on a checkpoint table, and a restart resumes from it,
+// or from the executed GTID set when GTID mode is on
+type BinlogListener struct {
+	serverID               uint32
+	heartbeat              time.Duration
+	retrier                event.Retrier
+	timeout                time.Duration
+	db                     *sql.DB
+	dsn                    *gomysql.Config
+	logger                 *slog.Logger
+	tableToChannelRelation map[string][]event.Channel
+	tables                 map[string]Table
+	columns                map[string]tableColumns
+	columnsFromDatabase    bool
+	tableMaps              map[uint64]tableMapEvent
+	names                  objectNames
+	checksum               bool
+	mariaDB                bool
+	gtidMode               bool
+	gtids                  gtidSet
+	tableIDSize            int
+	position               binlogPosition
+	checkpoint             binlogPosition
+	lastCheckpoint         time.Time
+	transactionMarkers     bool
+	inTransaction          bool
+	sequence               uint64
+	txID                   uint64
+	txGTID                 gtidEvent
+	txSeq                  uint64
+	txTableEvents          map[string]uint64
+}
+
+// Columns read from the database for the table map id they were loaded for
+type tableColumns struct {
+	tableID uint64
+	columns []binlogColumn
+}
+
+// Position after the last complete transaction, along with the id of the last
+// event published up to it and the GTIDs executed up to it
+type binlogPosition struct {
+	file     string
+	position uint32
+	sequence uint64
+	gtidSet  string
+}
+
+func NewBinlogListener(config Config, channels map[string]event.Channel) (*BinlogListener, error) {
+	listener := &BinlogListener{
+		serverID:    config.Binlog.ServerIDOrDefault(config.NamePrefixOrDefault()),
+		heartbeat:   config.Binlog.HeartbeatSecondsOrDefault(),
+		timeout:     config.TimeoutSecondsOrDefault(),
+		logger:      slog.With("listener", "MySQLBinlog"),
+		tables:      make(map[string]Table, len(config.Tables)),
+		columns:     make(map[string]tableColumns, len(config.Tables)),
+		tableMaps:   make(map[uint64]tableMapEvent),
+		tableIDSize: 6,
+		gtids:       gtidSet{},
+
+		columnsFromDatabase: config.Binlog.ColumnsFromDatabase,
+
+		transactionMarkers: event.UsesTransactionMarkers(channels),
+		txTableEvents:      make(map[string]uint64),
+	}
+
+	listener.retrier = event.Retrier{
+		Interval: config.PollSecondsOrDefault(),
+		Logger:   listener.logger,
+	}
+
+	for _, table := range config.Tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, dsn, err := openDatabase(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	listener.db = db
+	listener.dsn = dsn
+
+	listener.logger.Debug("Connected to database", "addr", dsn.Addr, "database", dsn.DBName)
+
+	if err := listener.setupDatabaseSchema(config, channels); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupPosition(); err != nil {
+		return nil, err
+	}
+
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
+	listener.logger.Info("Connector setup completed", "serverId", listener.serverID)
+
+	return listener, nil
+}
+
+// Reads the binlog until ctx is done. Closing the connection interrupts the
+// read, a rows event that was already read is still published
+func (l *BinlogListener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	conn, err := l.startBinlogDump()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Reads block until the next event or heartbeat, closing the connection
+	// is the only way to interrupt them
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	l.logger.Info(
+		"Streaming changes from binlog",
+		"file", l.position.file,
+		"position", l.position.position,
+		"gtidSet", l.position.gtidSet)
+
+	for {
+		data, err := conn.readEvent()
+		if err == nil {
+			err = l.handleEvent(ctx, data, callback)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				l.logger.Info("Listener stopped")
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// Saves the position of the last published transaction before closing the
+// connection, so the changes that were already published are not replayed
+func (l *BinlogListener) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var err error
+	if l.position != l.checkpoint {
+		err = l.saveCheckpoint(ctx)
+	}
+
+	return errors.Join(err, l.db.Close())
+}
+
+func (l *BinlogListener) WriteDeadLetter(ctx context.Context, deadLetter event.DeadLetter) error {
+	return eventtable.WriteDeadLetter(ctx, l.db, l.names.render(insertDeadLetterQuery), l.timeout, deadLetter)
+}
+
+func (l *BinlogListener) setupDatabaseSchema(config Config, channels map[string]event.Channel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var format, rowImage, checksum string
+	if err := l.db.QueryRowContext(ctx, getBinlogSettingsQuery).Scan(&format, &rowImage, &checksum); err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(format, "ROW") {
+		return fmt.Errorf("binlog_format must be ROW to read the changed rows, got [%s]", format)
+	}
+
+	if !strings.EqualFold(rowImage, "FULL") {
+		l.logger.Warn("binlog_row_image is not FULL, updates and deletes only carry some of the columns", "binlogRowImage", rowImage)
+	}
+
+	l.checksum = !strings.EqualFold(checksum, "NONE")
+
+	// MariaDB GTIDs are not compatible with the MySQL ones and do not have
+	// the variable, it resumes from the file and position instead
+	var gtidMode string
+	if err := l.db.QueryRowContext(ctx, getGTIDModeQuery).Scan(&gtidMode); err != nil {
+		l.logger.Debug("GTID mode is not available, resuming from the binlog file and position", "error", err.Error())
+	}
+
+	l.gtidMode = strings.EqualFold(gtidMode, "ON")
+
+	// Older servers do not have the variable and never write the column names
+	var rowMetadata string
+	if err := l.db.QueryRowContext(ctx, getBinlogRowMetadataQuery).Scan(&rowMetadata); err != nil {
+		l.logger.Debug("binlog_row_metadata is not available", "error", err.Error())
+	}
+
+	if !strings.EqualFold(rowMetadata, "FULL") {
+		if !l.columnsFromDatabase {
+			return fmt.Errorf(
+				"binlog_row_metadata must be FULL to read the column names from the binlog, got [%s], set binlog.columnsFromDatabase to read them from the database instead",
+				rowMetadata)
+		}
+
+		l.logger.Warn("binlog_row_metadata is not FULL, column names are read from the database", "binlogRowMetadata", rowMetadata)
+	}
+
+	var version string
+	if err := l.db.QueryRowContext(ctx, getServerVersionQuery).Scan(&version); err != nil {
+		return err
+	}
+
+	l.mariaDB = strings.Contains(strings.ToLower(version), "mariadb")
+
+	var database sql.NullString
+	if err := l.db.QueryRowContext(ctx, getCurrentDatabaseQuery).Scan(&database); err != nil {
+		return err
+	}
+
+	if database.String == "" {
+		return errors.New("the DSN does not select a database, it is required to create the checkpoint table")
+	}
+
+	l.names = newObjectNames(config, database.String)
+
+	queries := []string{setupBinlogCheckpointTableQuery}
+	if event.UsesDeadLetterTable(channels) {
+		queries = append(queries, setupFromToDeadLetterTableQuery)
+	}
+
+	for _, query := range queries {
+		if _, err := l.db.ExecContext(ctx, l.names.render(query)); err != nil {
+			return err
+		}
+	}
+
+	l.logger.Debug("Checkpoint table setup complete")
+
+	for _, table := range config.Tables {
+		table.schema, table.relation = table.SchemaAndRelation()
+		if table.schema == "" {
+			table.schema = database.String
+		}
+
+		columns, err := l.getColumns(ctx, table)
+		if err != nil {
+			return err
+		}
+
+		if len(columns) == 0 {
+			return fmt.Errorf("table [%s] does not exist", table.Name)
+		}
+
+		primaryKey, err := getPrimaryKeyColumns(ctx, l.db, table)
+		if err != nil {
+			return err
+		}
+
+		if len(primaryKey) == 0 {
+			l.logger.Debug("Table does not have a primary key, its events have no key", "table", table.Name)
+		}
+
+		table.primaryKey = primaryKey
+		l.tables[table.schema+"."+table.relation] = table
+
+		l.logger.Debug("Table setup complete", "table", table.Name)
+	}
+
+	return nil
+}
+
+// Resumes from the checkpoint, or from the current position of the server on
+// the first start, which is saved right away so later changes are not lost
+func (l *BinlogListener) setupPosition() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var position uint64
+	err := l.db.QueryRowContext(ctx, l.names.render(getBinlogCheckpointQuery)).Scan(
+		&l.position.file,
+		&position,
+		&l.position.sequence,
+		&l.position.gtidSet)
+	if err == nil {
+		l.position.position = uint32(position)
+		l.checkpoint = l.position
+		l.sequence = l.position.sequence
+
+		l.gtids, err = parseGTIDSet(l.position.gtidSet)
+		if err != nil {
+			return err
+		}
+
+		l.logger.Debug("Resuming from checkpoint", "file", l.position.file, "position", l.position.position)
+
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	l.position, err = l.getCurrentPosition(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.gtids, err = parseGTIDSet(l.position.gtidSet)
+	if err != nil {
+		return err
+	}
+
+	// Sets are formatted with line breaks by the server
+	l.position.gtidSet = l.gtids.String()
+
+	l.logger.Debug("No checkpoint found, starting from the current position", "file", l.position.file, "position", l.position.position)
+
+	return l.saveCheckpoint(ctx)
+}
+
+func (l *BinlogListener) getCurrentPosition(ctx context.Context) (binlogPosition, error) {
+	rows, err := l.db.QueryContext(ctx, getBinaryLogStatusQuery)
+	if err != nil {
+		rows, err = l.db.QueryContext(ctx, getMasterStatusQuery)
+	}
+
+	if err != nil {
+		return binlogPosition{}, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return binlogPosition{}, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return binlogPosition{}, err
+		}
+
+		return binlogPosition{}, errors.New("binary logging is disabled on the server")
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, 0, len(columns))
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return binlogPosition{}, err
+	}
+
+	position, err := strconv.ParseUint(values[1].String, 10, 32)
+	if err != nil {
+		return binlogPosition{}, err
+	}
+
+	current := binlogPosition{file: values[0].String, position: uint32(position)}
+
+	// Executed_Gtid_Set is only returned by MySQL
+	if len(values) > 4 {
+		current.gtidSet = values[4].String
+	}
+
+	return current, nil
+}
+
+func (l *BinlogListener) saveCheckpoint(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.timeout)
+	defer cancel()
+
+	_, err := l.db.ExecContext(
+		ctx,
+		l.names.render(saveBinlogCheckpointQuery),
+		l.position.file,
+		l.position.position,
+		l.position.sequence,
+		l.position.gtidSet)
+	if err != nil {
+		return err
+	}
+
+	l.checkpoint = l.position
+	l.lastCheckpoint = time.Now()
+
+	l.logger.Debug("Saved binlog checkpoint", "file", l.position.file, "position", l.position.position)
+
+	return nil
+}
+
+// Transactions with captured changes are checkpointed right away, the other
+// ones only move the position, which is saved at most once per heartbeat
+func (l *BinlogListener) checkpointIfDue(ctx context.Context, force bool) error {
+	if l.position == l.checkpoint {
+		return nil
+	}
+
+	if !force && time.Since(l.lastCheckpoint) < l.heartbeat {
+		return nil
+	}
+
+	return l.saveCheckpoint(ctx)
+}
+
+func (l *BinlogListener) startBinlogDump() (*binlogConn, error) {
+	network := l.dsn.Net
+	if network == "" {
+		network = "tcp"
+	}
+
+	// The server sends a heartbeat when there are no events, so a read that
+	// takes much longer than it means the connection was lost
+	conn, err := dialBinlogConn(network, l.dsn.Addr, l.timeout, 2*l.heartbeat)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.setupBinlogConn(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (l *BinlogListener) setupBinlogConn(conn *binlogConn) error {
+	if err := conn.authenticate(l.dsn.User, l.dsn.Passwd, l.dsn.TLS, l.dsn.AllowFallbackToPlaintext); err != nil {
+		return fmt.Errorf("Failed to authenticate replication connection, got error %s", err.Error())
+	}
+
+	queries := []string{
+		setMasterBinlogChecksumQuery,
+		setSourceBinlogChecksumQuery,
+		fmt.Sprintf(setMasterHeartbeatPeriodPartialQuery, l.heartbeat.Nanoseconds()),
+		fmt.Sprintf(setSourceHeartbeatPeriodPartialQuery, l.heartbeat.Nanoseconds()),
+	}
+
+	for _, query := range queries {
+		if err := conn.exec(query); err != nil {
+			return err
+		}
+	}
+
+	// Resuming from the GTID set does not depend on the binlog file names,
+	// which change when the server fails over to another source
+	if l.gtidMode && len(l.gtids) > 0 {
+		return conn.startBinlogDumpGTID(l.serverID, l.gtids.encode())
+	}
+
+	return conn.startBinlogDump(l.serverID, l.position.file, l.position.position)
+}
+
+func (l *BinlogListener) handleEvent(
+	ctx context.Context,
+	data []byte,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	header, err := parseBinlogEventHeader(data)
+	if err != nil {
+		return err
+	}
+
+	end := len(data)
+	if l.checksum {
+		end -= _binlogChecksumLength
+	}
+
+	if end < _binlogEventHeaderLength {
+		return fmt.Errorf("received a truncated binlog event of type %d", header.eventType)
+	}
+
+	body := data[_binlogEventHeaderLength:end]
+
+	switch header.eventType {
+	case _binlogRotateEvent:
+		rotate, err := parseRotate(body)
+		if err != nil {
+			return err
+		}
+
+		l.position.file = rotate.file
+		l.position.position = uint32(rotate.position)
+
+		return l.checkpointIfDue(ctx, false)
+
+	case _binlogFormatDescriptionEvent:
+		l.tableIDSize, err = parseFormatDescription(body)
+		return err
+
+	case _binlogGTIDEvent, _binlogAnonymousGTIDEvent, _mariaDBGTIDEvent:
+		l.txGTID, err = parseGTID(header.eventType, body)
+		if err != nil {
+			return err
+		}
+
+		l.txID = l.txGTID.transaction
+		l.startTransaction()
+		l.inTransaction = header.eventType == _mariaDBGTIDEvent && !l.txGTID.standalone
+
+		return nil
+
+	case _binlogQueryEvent:
+		query, err := parseQuery(body)
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToUpper(strings.TrimSpace(query.query)) {
+		case "BEGIN":
+			l.startTransaction()
+			l.inTransaction = true
+
+			return nil
+
+		case "COMMIT", "ROLLBACK":
+			return l.endTransaction(ctx, header, callback)
+		}
+
+		// Statements outside of a transaction, such as DDL, are a transaction
+		// of their own
+		if l.inTransaction {
+			return nil
+		}
+
+		return l.endTransaction(ctx, header, callback)
+
+	case _binlogTableMapEvent:
+		tableMap, err := parseTableMap(body, l.tableIDSize, l.mariaDB)
+		if err != nil {
+			return err
+		}
+
+		l.tableMaps[tableMap.tableID] = tableMap
+
+	case _binlogWriteRowsEventV1, _binlogUpdateRowsEventV1, _binlogDeleteRowsEventV1,
+		_binlogWriteRowsEventV2, _binlogUpdateRowsEventV2, _binlogDeleteRowsEventV2:
+		return l.handleRows(ctx, header, body, callback)
+
+	case _binlogXIDEvent:
+		return l.endTransaction(ctx, header, callback)
+	}
+
+	return nil
+}
+
+func (l *BinlogListener) startTransaction() {
+	l.txSeq = 0
+	clear(l.txTableEvents)
+}
+
+func (l *BinlogListener) endTransaction(
+	ctx context.Context,
+	header binlogEventHeader,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	captured := len(l.txTableEvents) > 0
+
+	if l.transactionMarkers && captured {
+		l.txSeq++
+
+		marker := l.newEvent(header, event.OpCommit)
+		marker.Row = event.NewTransactionMarker(l.txTableEvents)
+
+		if err := l.publishEvent(ctx, marker, callback); err != nil {
+			return err
+		}
+	}
+
+	// Only move the position after every change of the transaction was
+	// published, so a restart replays anything that was not processed
+	l.inTransaction = false
+	l.position.position = header.logPos
+	l.position.sequence = l.sequence
+
+	if l.txGTID.sourceID != "" {
+		l.gtids.add(l.txGTID.sourceID, l.txGTID.transaction)
+		l.position.gtidSet = l.gtids.String()
+		l.txGTID = gtidEvent{}
+	}
+
+	return l.checkpointIfDue(ctx, captured)
+}
+
+func (l *BinlogListener) handleRows(
+	ctx context.Context,
+	header binlogEventHeader,
+	body []byte,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	tableID, err := parseRowsTableID(body, l.tableIDSize)
+	if err != nil {
+		return err
+	}
+
+	tableMap, exists := l.tableMaps[tableID]
+	if !exists {
+		return fmt.Errorf("received rows for unknown table id %d", tableID)
+	}
+
+	table, captured := l.tables[tableMap.schema+"."+tableMap.table]
+	if !captured {
+		return nil
+	}
+
+	columns, err := l.getTableMapColumns(ctx, table, tableMap)
+	if err != nil {
+		return err
+	}
+
+	if columns == nil {
+		return nil
+	}
+
+	rows, err := parseRows(header.eventType, body, l.tableIDSize, tableMap, columns)
+	if err != nil {
+		return fmt.Errorf("Failed to parse rows of table [%s], got error %s", table.Name, err.Error())
+	}
+
+	if !slices.Contains(table.OperationsOrDefault(), rows.op) {
+		l.logger.Debug("Operation is not captured for table, skipping", "table", table.Name, "op", rows.op)
+		return nil
+	}
+
+	step := 1
+	if rows.op == OperationUpdate {
+		step = 2
+	}
+
+	for i := 0; i+step <= len(rows.rows); i += step {
+		// Operations filtered out of the table do not count on the marker
+		l.txSeq++
+		l.txTableEvents[tableMap.schema+"."+tableMap.table]++
+
+		e := l.newEvent(header, rows.op)
+		e.Schema = tableMap.schema
+		e.Table = tableMap.table
+		e.Row = rows.rows[i]
+
+		if rows.op == OperationUpdate {
+			e.Before = rows.rows[i]
+			e.Row = rows.rows[i+1]
+
+			if table.ChangedColumns {
+				e.Changed = event.ChangedColumns(e.Before, e.Row)
+			}
+		}
+
+		e.Key = event.KeyFromRow(table.primaryKey, e.Row)
+
+		if err := l.publishEvent(ctx, e, callback); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns an event of the current transaction. Ids come from a sequence that
+// is saved with the checkpoint, so a replayed change gets the same id again
+func (l *BinlogListener) newEvent(header binlogEventHeader, op string) event.Event {
+	timestamp := time.Unix(int64(header.timestamp), 0)
+	l.sequence++
+
+	return event.Event{
+		ID:        l.sequence,
+		Ts:        uint64(header.timestamp),
+		Timestamp: timestamp,
+		TxID:      l.txID,
+		TxSeq:     l.txSeq,
+		Op:        op,
+	}
+}
+
+// Columns come from the table map when it has the names, so they always match
+// the row images. Otherwise they are read from the database once per table
+// map id, which changes along with the table definition. Returns nil if the
+// table changed after the rows were written, and the rows are skipped
+func (l *BinlogListener) getTableMapColumns(ctx context.Context, table Table, tableMap tableMapEvent) ([]binlogColumn, error) {
+	if tableMap.columns != nil {
+		return tableMap.columns, nil
+	}
+
+	if !l.columnsFromDatabase {
+		return nil, fmt.Errorf(
+			"the binlog does not have the column names of table [%s], set binlog_row_metadata=FULL on the server, or binlog.columnsFromDatabase to read them from the database",
+			table.Name)
+	}
+
+	name := table.schema + "." + table.relation
+
+	cached, exists := l.columns[name]
+	if !exists || cached.tableID != tableMap.tableID {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.timeout)
+		defer cancel()
+
+		columns, err := l.getColumns(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+
+		cached = tableColumns{tableID: tableMap.tableID, columns: columns}
+		l.columns[name] = cached
+	}
+
+	if len(cached.columns) != len(tableMap.columnTypes) {
+		l.logger.Error(
+			"Table has a different number of columns on the binlog and on the database, skipping its rows",
+			"table", table.Name,
+			"binlogColumns", len(tableMap.columnTypes),
+			"databaseColumns", len(cached.columns))
+
+		return nil, nil
+	}
+
+	return cached.columns, nil
+}
+
+func (l *BinlogListener) getColumns(ctx context.Context, table Table) ([]binlogColumn, error) {
+	rows, err := l.db.QueryContext(ctx, getBinlogColumnsQuery, table.schema, table.relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []binlogColumn
+	for rows.Next() {
+		var name, dataType, columnType string
+		if err := rows.Scan(&name, &dataType, &columnType); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, newBinlogColumn(name, dataType, columnType))
+	}
+
+	return columns, rows.Err()
+}
+
+// The position is not checkpointed while the event is retried, so the change
+// is replayed if the application stops before every channel acknowledged it
+func (l *BinlogListener) publishEvent(
+	ctx context.Context,
+	e event.Event,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	return l.retrier.Publish(ctx, e, l.tableToChannelRelation, callback)
+}
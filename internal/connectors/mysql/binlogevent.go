@@ -0,0 +1,442 @@
+package mysql
+
+import "math/bits"
+
+const (
+	_binlogEventHeaderLength = 19
+	_binlogChecksumLength    = 4
+
+	_binlogQueryEvent             = 2
+	_binlogRotateEvent            = 4
+	_binlogFormatDescriptionEvent = 15
+	_binlogXIDEvent               = 16
+	_binlogTableMapEvent          = 19
+	_binlogWriteRowsEventV1       = 23
+	_binlogUpdateRowsEventV1      = 24
+	_binlogDeleteRowsEventV1      = 25
+	_binlogWriteRowsEventV2       = 30
+	_binlogUpdateRowsEventV2      = 31
+	_binlogDeleteRowsEventV2      = 32
+	_binlogGTIDEvent              = 33
+	_binlogAnonymousGTIDEvent     = 34
+	_mariaDBGTIDEvent             = 162
+
+	_mariaDBGTIDStandalone = 0x01
+
+	// Optional metadata of table maps, written by MySQL 8.0.1 and MariaDB
+	// 10.5 or later. The names and values are only written with
+	// binlog_row_metadata=FULL
+	_tableMapSignedness     = 1
+	_tableMapDefaultCharset = 2
+	_tableMapColumnCharset  = 3
+	_tableMapColumnName     = 4
+	_tableMapSetValues      = 5
+	_tableMapEnumValues     = 6
+
+	_binaryCollation = 63
+)
+
+type binlogEventHeader struct {
+	timestamp uint32
+	eventType byte
+	serverID  uint32
+	eventSize uint32
+	logPos    uint32
+	flags     uint16
+}
+
+type rotateEvent struct {
+	position uint64
+	file     string
+}
+
+type gtidEvent struct {
+	sourceID    string
+	transaction uint64
+
+	// Other MariaDB transactions start with the GTID instead of a BEGIN
+	// query, standalone ones are a single statement such as DDL
+	standalone bool
+}
+
+type queryEvent struct {
+	schema string
+	query  string
+}
+
+type tableMapEvent struct {
+	tableID     uint64
+	schema      string
+	table       string
+	columnTypes []byte
+	columnMeta  []uint16
+
+	// Built from the optional metadata, nil if it does not have the names
+	columns []binlogColumn
+}
+
+type rowsEvent struct {
+	tableID uint64
+	op      string
+
+	// Before and after images for updates, a single image otherwise
+	rows []map[string]any
+}
+
+func parseBinlogEventHeader(data []byte) (binlogEventHeader, error) {
+	r := packetReader{data: data}
+	header := binlogEventHeader{
+		timestamp: r.uint32(),
+		eventType: r.byte(),
+		serverID:  r.uint32(),
+		eventSize: r.uint32(),
+		logPos:    r.uint32(),
+		flags:     r.uint16(),
+	}
+
+	return header, r.err
+}
+
+func parseRotate(data []byte) (rotateEvent, error) {
+	r := packetReader{data: data}
+	rotate := rotateEvent{
+		position: r.uint64(),
+		file:     string(r.rest()),
+	}
+
+	return rotate, r.err
+}
+
+// Returns the size of table ids, which is 4 bytes on servers older than 5.1
+// and 6 bytes on every other one
+func parseFormatDescription(data []byte) (int, error) {
+	r := packetReader{data: data}
+	r.take(2)  // Binlog version
+	r.take(50) // Server version
+	r.take(4)  // Creation timestamp
+	r.take(1)  // Event header length
+	postHeaderLengths := r.rest()
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if len(postHeaderLengths) >= _binlogTableMapEvent && postHeaderLengths[_binlogTableMapEvent-1] == 6 {
+		return 4, nil
+	}
+
+	return 6, nil
+}
+
+func parseQuery(data []byte) (queryEvent, error) {
+	r := packetReader{data: data}
+	r.take(4) // Thread id
+	r.take(4) // Execution time
+	schemaLength := int(r.byte())
+	r.take(2) // Error code
+	r.take(int(r.uint16()))
+
+	query := queryEvent{
+		schema: string(r.take(schemaLength)),
+	}
+
+	r.take(1)
+	query.query = string(r.rest())
+
+	return query, r.err
+}
+
+// Returns the GTID of the next transaction. MariaDB GTIDs have no source id,
+// their transaction is the sequence number
+func parseGTID(eventType byte, data []byte) (gtidEvent, error) {
+	r := packetReader{data: data}
+	if eventType == _mariaDBGTIDEvent {
+		gtid := gtidEvent{transaction: r.uint64()}
+		r.take(4) // Domain id
+		gtid.standalone = r.byte()&_mariaDBGTIDStandalone != 0
+
+		return gtid, r.err
+	}
+
+	r.take(1) // Flags
+	sourceID := r.take(16)
+	gtid := gtidEvent{transaction: r.uint64()}
+
+	// Anonymous GTIDs, written while GTID mode is off, have a zeroed source id
+	if eventType == _binlogGTIDEvent && r.err == nil {
+		gtid.sourceID = formatGTIDSourceID(sourceID)
+	}
+
+	return gtid, r.err
+}
+
+// MariaDB also counts geometry columns as character columns on the charset
+// metadata
+func parseTableMap(data []byte, tableIDSize int, mariaDB bool) (tableMapEvent, error) {
+	r := packetReader{data: data}
+	tableMap := tableMapEvent{
+		tableID: r.uintN(tableIDSize),
+	}
+
+	r.take(2) // Flags
+	tableMap.schema = string(r.take(int(r.byte())))
+	r.take(1)
+	tableMap.table = string(r.take(int(r.byte())))
+	r.take(1)
+
+	columnCount := int(r.lengthEncodedInt())
+	tableMap.columnTypes = r.take(columnCount)
+
+	meta := packetReader{data: r.take(int(r.lengthEncodedInt()))}
+	tableMap.columnMeta = make([]uint16, len(tableMap.columnTypes))
+	for i, columnType := range tableMap.columnTypes {
+		switch columnType {
+		case _mysqlTypeString, _mysqlTypeNewDecimal:
+			tableMap.columnMeta[i] = uint16(meta.byte())<<8 | uint16(meta.byte())
+		case _mysqlTypeVarchar, _mysqlTypeVarString, _mysqlTypeBit:
+			tableMap.columnMeta[i] = meta.uint16()
+		case _mysqlTypeBlob, _mysqlTypeGeometry, _mysqlTypeJSON, _mysqlTypeFloat, _mysqlTypeDouble,
+			_mysqlTypeTime2, _mysqlTypeDatetime2, _mysqlTypeTimestamp2:
+			tableMap.columnMeta[i] = uint16(meta.byte())
+		}
+	}
+
+	if meta.err != nil {
+		return tableMap, meta.err
+	}
+
+	r.take((columnCount + 7) / 8) // Nullable columns
+	if r.err != nil {
+		return tableMap, r.err
+	}
+
+	columns, err := parseTableMapColumns(&r, tableMap, mariaDB)
+	if err != nil {
+		return tableMap, err
+	}
+
+	tableMap.columns = columns
+
+	return tableMap, nil
+}
+
+// Returns the columns described by the optional metadata, or nil if it does
+// not have the column names
+func parseTableMapColumns(r *packetReader, tableMap tableMapEvent, mariaDB bool) ([]binlogColumn, error) {
+	var names []string
+	var signedness []byte
+	var setValues, enumValues [][]string
+
+	// Collations by the index of the column among the character columns
+	var defaultCollation uint64
+	collations := make(map[int]uint64)
+
+	for r.err == nil && r.remaining() > 0 {
+		fieldType := r.byte()
+		field := packetReader{data: r.take(int(r.lengthEncodedInt()))}
+
+		switch fieldType {
+		case _tableMapSignedness:
+			signedness = field.rest()
+
+		case _tableMapDefaultCharset:
+			defaultCollation = field.lengthEncodedInt()
+			for field.err == nil && field.remaining() > 0 {
+				index := int(field.lengthEncodedInt())
+				collations[index] = field.lengthEncodedInt()
+			}
+
+		case _tableMapColumnCharset:
+			for i := 0; field.err == nil && field.remaining() > 0; i++ {
+				collations[i] = field.lengthEncodedInt()
+			}
+
+		case _tableMapColumnName:
+			for field.err == nil && field.remaining() > 0 {
+				names = append(names, string(field.take(int(field.lengthEncodedInt()))))
+			}
+
+		case _tableMapSetValues:
+			setValues = parseTableMapValues(&field)
+
+		case _tableMapEnumValues:
+			enumValues = parseTableMapValues(&field)
+		}
+
+		if field.err != nil {
+			return nil, field.err
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if len(names) != len(tableMap.columnTypes) {
+		return nil, nil
+	}
+
+	columns := make([]binlogColumn, len(names))
+	var numeric, character, sets, enums int
+	for i, name := range names {
+		columns[i].name = name
+
+		switch realType := tableMap.realType(i); realType {
+		case _mysqlTypeTiny, _mysqlTypeShort, _mysqlTypeInt24, _mysqlTypeLong, _mysqlTypeLongLong,
+			_mysqlTypeFloat, _mysqlTypeDouble, _mysqlTypeDecimal, _mysqlTypeNewDecimal:
+			// The most significant bit is the first numeric column
+			columns[i].unsigned = numeric/8 < len(signedness) && signedness[numeric/8]&(0x80>>(numeric%8)) != 0
+			numeric++
+
+		case _mysqlTypeString, _mysqlTypeVarString, _mysqlTypeVarchar, _mysqlTypeBlob:
+			collation, exists := collations[character]
+			if !exists {
+				collation = defaultCollation
+			}
+
+			columns[i].binary = collation == _binaryCollation
+			character++
+
+		case _mysqlTypeGeometry:
+			columns[i].binary = true
+			if mariaDB {
+				character++
+			}
+
+		case _mysqlTypeSet:
+			if sets < len(setValues) {
+				columns[i].values = setValues[sets]
+			}
+
+			sets++
+
+		case _mysqlTypeEnum:
+			if enums < len(enumValues) {
+				columns[i].values = enumValues[enums]
+			}
+
+			enums++
+		}
+	}
+
+	return columns, nil
+}
+
+// Reads the values of every enum or set column, each as a count followed by
+// the values
+func parseTableMapValues(r *packetReader) [][]string {
+	var columns [][]string
+	for r.err == nil && r.remaining() > 0 {
+		count := int(r.lengthEncodedInt())
+		values := make([]string, 0, min(count, r.remaining()))
+		for range count {
+			values = append(values, string(r.take(int(r.lengthEncodedInt()))))
+		}
+
+		columns = append(columns, values)
+	}
+
+	return columns
+}
+
+// Enum and set columns are written as strings, with the real type on the
+// metadata. Bits of the real type are taken by the length of long strings
+func (t tableMapEvent) realType(i int) byte {
+	if t.columnTypes[i] != _mysqlTypeString {
+		return t.columnTypes[i]
+	}
+
+	realType := byte(t.columnMeta[i] >> 8)
+	if realType&0x30 != 0x30 {
+		realType |= 0x30
+	}
+
+	return realType
+}
+
+// Returns the id of the table changed by a rows event, so its table map and
+// columns can be found before parsing the rows
+func parseRowsTableID(data []byte, tableIDSize int) (uint64, error) {
+	r := packetReader{data: data}
+	return r.uintN(tableIDSize), r.err
+}
+
+// Decodes every row of the event with the columns of its table
+func parseRows(
+	eventType byte,
+	data []byte,
+	tableIDSize int,
+	tableMap tableMapEvent,
+	columns []binlogColumn,
+) (rowsEvent, error) {
+	r := packetReader{data: data}
+	rows := rowsEvent{
+		tableID: r.uintN(tableIDSize),
+	}
+
+	r.take(2) // Flags
+
+	switch eventType {
+	case _binlogWriteRowsEventV2, _binlogUpdateRowsEventV2, _binlogDeleteRowsEventV2:
+		r.take(int(r.uint16()) - 2) // Extra data
+	}
+
+	switch eventType {
+	case _binlogWriteRowsEventV1, _binlogWriteRowsEventV2:
+		rows.op = OperationInsert
+	case _binlogUpdateRowsEventV1, _binlogUpdateRowsEventV2:
+		rows.op = OperationUpdate
+	case _binlogDeleteRowsEventV1, _binlogDeleteRowsEventV2:
+		rows.op = OperationDelete
+	}
+
+	columnCount := int(r.lengthEncodedInt())
+	present := r.take((columnCount + 7) / 8)
+	presentAfter := present
+	if rows.op == OperationUpdate {
+		presentAfter = r.take((columnCount + 7) / 8)
+	}
+
+	for r.err == nil && r.remaining() > 0 {
+		rows.rows = append(rows.rows, parseRowImage(&r, tableMap, columns, present))
+
+		if rows.op == OperationUpdate {
+			rows.rows = append(rows.rows, parseRowImage(&r, tableMap, columns, presentAfter))
+		}
+	}
+
+	return rows, r.err
+}
+
+// Columns missing from the image, as with binlog_row_image=MINIMAL, are left
+// out of the row
+func parseRowImage(r *packetReader, tableMap tableMapEvent, columns []binlogColumn, present []byte) map[string]any {
+	presentCount := 0
+	for _, b := range present {
+		presentCount += bits.OnesCount8(b)
+	}
+
+	nulls := r.take((presentCount + 7) / 8)
+	row := make(map[string]any, presentCount)
+
+	index := 0
+	for i, columnType := range tableMap.columnTypes {
+		if !isBitSet(present, i) {
+			continue
+		}
+
+		isNull := isBitSet(nulls, index)
+		index++
+		if isNull {
+			row[columns[i].name] = nil
+			continue
+		}
+
+		row[columns[i].name] = decodeBinlogValue(r, columnType, tableMap.columnMeta[i], columns[i])
+	}
+
+	return row
+}
+
+func isBitSet(bitmap []byte, i int) bool {
+	return i/8 < len(bitmap) && bitmap[i/8]&(1<<(i%8)) != 0
+}
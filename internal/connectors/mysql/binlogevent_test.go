@@ -0,0 +1,208 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Table map of a table (a INT, b VARCHAR(20), c INT)
+var _rowsTableMap = tableMapEvent{
+	tableID:     42,
+	schema:      "shop",
+	table:       "sales",
+	columnTypes: []byte{_mysqlTypeLong, _mysqlTypeVarchar, _mysqlTypeLong},
+	columnMeta:  []uint16{0, 20, 0},
+}
+
+var _rowsColumns = []binlogColumn{{name: "a"}, {name: "b"}, {name: "c"}}
+
+func TestParseRows(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType byte
+		data      []byte
+		op        string
+		expected  []map[string]any
+	}{
+		{
+			"write with nulls",
+			_binlogWriteRowsEventV2,
+			[]byte{
+				0x2a, 0x00, 0x00, 0x00, 0x00, 0x00, // table id
+				0x00, 0x00, // flags
+				0x02, 0x00, // extra data length
+				0x03,       // columns
+				0b00000111, // present columns
+				0b00000010, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+				0b00000000, 0x02, 0x00, 0x00, 0x00, 0x02, 'h', 'i', 0x04, 0x00, 0x00, 0x00,
+			},
+			OperationInsert,
+			[]map[string]any{
+				{"a": float64(1), "b": nil, "c": float64(3)},
+				{"a": float64(2), "b": "hi", "c": float64(4)},
+			},
+		},
+		{
+			"update with a minimal before image",
+			_binlogUpdateRowsEventV2,
+			[]byte{
+				0x2a, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00,
+				0x02, 0x00,
+				0x03,
+				0b00000101, // present columns of the before image
+				0b00000111, // present columns of the after image
+				0b00000000, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+				0b00000100, 0x01, 0x00, 0x00, 0x00, 0x01, 'x',
+			},
+			OperationUpdate,
+			[]map[string]any{
+				{"a": float64(1), "c": float64(3)},
+				{"a": float64(1), "b": "x", "c": nil},
+			},
+		},
+		{
+			"delete without extra data",
+			_binlogDeleteRowsEventV1,
+			[]byte{
+				0x2a, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00,
+				0x03,
+				0b00000011,
+				0b00000000, 0x05, 0x00, 0x00, 0x00, 0x00,
+			},
+			OperationDelete,
+			[]map[string]any{
+				{"a": float64(5), "b": ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := parseRows(test.eventType, test.data, 6, _rowsTableMap, _rowsColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rows.tableID != 42 || rows.op != test.op {
+				t.Errorf("expected table 42 and op %s, got table %d and op %s", test.op, rows.tableID, rows.op)
+			}
+
+			if !reflect.DeepEqual(rows.rows, test.expected) {
+				t.Errorf("expected rows %v, got %v", test.expected, rows.rows)
+			}
+		})
+	}
+}
+
+func TestParseRowsTruncated(t *testing.T) {
+	data := []byte{
+		0x2a, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+		0x02, 0x00,
+		0x03,
+		0b00000111,
+		0b00000000, 0x01, 0x00,
+	}
+
+	if _, err := parseRows(_binlogWriteRowsEventV2, data, 6, _rowsTableMap, _rowsColumns); err == nil {
+		t.Error("expected an error parsing a truncated row")
+	}
+}
+
+func TestIsBitSet(t *testing.T) {
+	bitmap := []byte{0b10000001, 0b00000010}
+
+	for i, expected := range []bool{true, false, false, false, false, false, false, true, false, true} {
+		if isBitSet(bitmap, i) != expected {
+			t.Errorf("bit %d: expected %t", i, expected)
+		}
+	}
+}
+
+// Table map of a table (id INT UNSIGNED, name VARCHAR(20), data VARBINARY(10),
+// status ENUM('a', 'b'), tags SET('x', 'y'))
+var _tableMapData = []byte{
+	0x2a, 0x00, 0x00, 0x00, 0x00, 0x00, // table id
+	0x01, 0x00, // flags
+	0x04, 's', 'h', 'o', 'p', 0x00,
+	0x05, 's', 'a', 'l', 'e', 's', 0x00,
+	0x05, // columns
+	_mysqlTypeLong, _mysqlTypeVarchar, _mysqlTypeVarchar, _mysqlTypeString, _mysqlTypeString,
+	0x08, 0x50, 0x00, 0x0a, 0x00, _mysqlTypeEnum, 0x01, _mysqlTypeSet, 0x01, // metadata
+	0b00011110, // nullable columns
+}
+
+var _tableMapOptionalMetadata = []byte{
+	_tableMapSignedness, 0x01, 0b10000000,
+	_tableMapDefaultCharset, 0x03, 45, 0x01, _binaryCollation,
+	_tableMapColumnName, 0x19,
+	0x02, 'i', 'd',
+	0x04, 'n', 'a', 'm', 'e',
+	0x04, 'd', 'a', 't', 'a',
+	0x06, 's', 't', 'a', 't', 'u', 's',
+	0x04, 't', 'a', 'g', 's',
+	_tableMapSetValues, 0x05, 0x02, 0x01, 'x', 0x01, 'y',
+	_tableMapEnumValues, 0x05, 0x02, 0x01, 'a', 0x01, 'b',
+}
+
+func TestParseTableMap(t *testing.T) {
+	data := append(append([]byte{}, _tableMapData...), _tableMapOptionalMetadata...)
+
+	tableMap, err := parseTableMap(data, 6, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tableMap.tableID != 42 || tableMap.schema != "shop" || tableMap.table != "sales" {
+		t.Errorf("unexpected table %d %s.%s", tableMap.tableID, tableMap.schema, tableMap.table)
+	}
+
+	if !reflect.DeepEqual(tableMap.columnMeta, []uint16{0, 80, 10, 0xf701, 0xf801}) {
+		t.Errorf("unexpected column metadata %v", tableMap.columnMeta)
+	}
+
+	expected := []binlogColumn{
+		{name: "id", unsigned: true},
+		{name: "name"},
+		{name: "data", binary: true},
+		{name: "status", values: []string{"a", "b"}},
+		{name: "tags", values: []string{"x", "y"}},
+	}
+
+	if !reflect.DeepEqual(tableMap.columns, expected) {
+		t.Errorf("expected columns %v, got %v", expected, tableMap.columns)
+	}
+}
+
+func TestParseTableMapWithoutColumnNames(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"without optional metadata", _tableMapData},
+		{"minimal optional metadata", append(append([]byte{}, _tableMapData...), _tableMapOptionalMetadata[:8]...)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tableMap, err := parseTableMap(test.data, 6, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tableMap.columns != nil {
+				t.Errorf("expected no columns, got %v", tableMap.columns)
+			}
+		})
+	}
+}
+
+func TestParseTableMapTruncatedMetadata(t *testing.T) {
+	data := append(append([]byte{}, _tableMapData...), _tableMapColumnName, 0x19, 0x02, 'i')
+
+	if _, err := parseTableMap(data, 6, false); err == nil {
+		t.Error("expected an error parsing truncated optional metadata")
+	}
+}
@@ -0,0 +1,148 @@
+package mysql
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Transactions executed by each source, by the source uuid. Intervals are
+// sorted, inclusive and never overlap
+type gtidSet map[string][]gtidInterval
+
+type gtidInterval struct {
+	start uint64
+	end   uint64
+}
+
+// Parses a set as formatted by the server, such as
+// 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,8a94f357-aab4-11df-86ab-c80aa9429563:1
+func parseGTIDSet(s string) (gtidSet, error) {
+	set := gtidSet{}
+	for _, source := range strings.Split(s, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+
+		parts := strings.Split(source, ":")
+		sourceID := strings.ToLower(parts[0])
+		if _, err := gtidSourceIDBytes(sourceID); err != nil {
+			return nil, err
+		}
+
+		for _, part := range parts[1:] {
+			start, end, isRange := strings.Cut(part, "-")
+			if !isRange {
+				end = start
+			}
+
+			startNumber, err := strconv.ParseUint(start, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid GTID interval [%s] of source [%s], tagged GTIDs are not supported", part, sourceID)
+			}
+
+			endNumber, err := strconv.ParseUint(end, 10, 64)
+			if err != nil || endNumber < startNumber {
+				return nil, fmt.Errorf("invalid GTID interval [%s] of source [%s]", part, sourceID)
+			}
+
+			set[sourceID] = set.merge(sourceID, gtidInterval{start: startNumber, end: endNumber})
+		}
+	}
+
+	return set, nil
+}
+
+func (s gtidSet) add(sourceID string, transaction uint64) {
+	s[sourceID] = s.merge(sourceID, gtidInterval{start: transaction, end: transaction})
+}
+
+func (s gtidSet) merge(sourceID string, interval gtidInterval) []gtidInterval {
+	intervals := append(slices.Clone(s[sourceID]), interval)
+	slices.SortFunc(intervals, func(a, b gtidInterval) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	merged := intervals[:1]
+	for _, next := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if next.start > last.end+1 {
+			merged = append(merged, next)
+			continue
+		}
+
+		last.end = max(last.end, next.end)
+	}
+
+	return merged
+}
+
+func (s gtidSet) String() string {
+	sourceIDs := make([]string, 0, len(s))
+	for sourceID := range s {
+		sourceIDs = append(sourceIDs, sourceID)
+	}
+
+	slices.Sort(sourceIDs)
+
+	sources := make([]string, 0, len(sourceIDs))
+	for _, sourceID := range sourceIDs {
+		var source strings.Builder
+		source.WriteString(sourceID)
+
+		for _, interval := range s[sourceID] {
+			source.WriteString(":" + strconv.FormatUint(interval.start, 10))
+			if interval.end != interval.start {
+				source.WriteString("-" + strconv.FormatUint(interval.end, 10))
+			}
+		}
+
+		sources = append(sources, source.String())
+	}
+
+	return strings.Join(sources, ",")
+}
+
+// Encodes the set as sent by COM_BINLOG_DUMP_GTID, where interval ends are
+// exclusive
+func (s gtidSet) encode() []byte {
+	sourceIDs := make([]string, 0, len(s))
+	for sourceID := range s {
+		sourceIDs = append(sourceIDs, sourceID)
+	}
+
+	slices.Sort(sourceIDs)
+
+	data := appendUint64(nil, uint64(len(sourceIDs)))
+	for _, sourceID := range sourceIDs {
+		id, _ := gtidSourceIDBytes(sourceID)
+		data = append(data, id...)
+		data = appendUint64(data, uint64(len(s[sourceID])))
+
+		for _, interval := range s[sourceID] {
+			data = appendUint64(data, interval.start)
+			data = appendUint64(data, interval.end+1)
+		}
+	}
+
+	return data
+}
+
+func gtidSourceIDBytes(sourceID string) ([]byte, error) {
+	id, err := hex.DecodeString(strings.ReplaceAll(sourceID, "-", ""))
+	if err != nil || len(id) != 16 {
+		return nil, fmt.Errorf("invalid GTID source id [%s]", sourceID)
+	}
+
+	return id, nil
+}
+
+func formatGTIDSourceID(id []byte) string {
+	s := hex.EncodeToString(id)
+
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
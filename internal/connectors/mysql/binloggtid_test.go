@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	_testSourceA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	_testSourceB = "8a94f357-aab4-11df-86ab-c80aa9429563"
+)
+
+func TestParseGTIDSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"single transaction", _testSourceA + ":7", _testSourceA + ":7"},
+		{"intervals", _testSourceA + ":1-5:7-9", _testSourceA + ":1-5:7-9"},
+		{"adjacent intervals are merged", _testSourceA + ":1-5:6-9", _testSourceA + ":1-9"},
+		{"server line breaks", _testSourceB + ":1,\n" + _testSourceA + ":1-3", _testSourceA + ":1-3," + _testSourceB + ":1"},
+		{"upper case source", "3E11FA47-71CA-11E1-9E33-C80AA9429562:1", _testSourceA + ":1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := parseGTIDSet(test.set)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if set.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, set.String())
+			}
+		})
+	}
+
+	for _, invalid := range []string{"not-a-uuid:1", _testSourceA + ":5-1", _testSourceA + ":tag:1-5"} {
+		if _, err := parseGTIDSet(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestGTIDSetAdd(t *testing.T) {
+	set, _ := parseGTIDSet(_testSourceA + ":1-3:5")
+
+	set.add(_testSourceA, 4)
+	set.add(_testSourceA, 7)
+	set.add(_testSourceB, 1)
+
+	expected := _testSourceA + ":1-5:7," + _testSourceB + ":1"
+	if set.String() != expected {
+		t.Errorf("expected %q, got %q", expected, set.String())
+	}
+}
+
+func TestGTIDSetEncode(t *testing.T) {
+	set, _ := parseGTIDSet(_testSourceA + ":1-5:7")
+
+	expected := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	expected = append(expected, 0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62)
+	expected = append(expected, 2, 0, 0, 0, 0, 0, 0, 0)
+	expected = append(expected, 1, 0, 0, 0, 0, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0)
+	expected = append(expected, 7, 0, 0, 0, 0, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0)
+
+	if encoded := set.encode(); !bytes.Equal(encoded, expected) {
+		t.Errorf("expected %v, got %v", expected, encoded)
+	}
+}
+
+func TestParseGTID(t *testing.T) {
+	body := []byte{0x01, 0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+	body = append(body, 42, 0, 0, 0, 0, 0, 0, 0)
+
+	gtid, err := parseGTID(_binlogGTIDEvent, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gtid.sourceID != _testSourceA || gtid.transaction != 42 {
+		t.Errorf("unexpected GTID %+v", gtid)
+	}
+
+	anonymous, err := parseGTID(_binlogAnonymousGTIDEvent, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if anonymous.sourceID != "" {
+		t.Errorf("anonymous GTIDs should not have a source id, got %q", anonymous.sourceID)
+	}
+
+	mariaDB, err := parseGTID(_mariaDBGTIDEvent, []byte{9, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, _mariaDBGTIDStandalone})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mariaDB.sourceID != "" || mariaDB.transaction != 9 || !mariaDB.standalone {
+		t.Errorf("unexpected MariaDB GTID %+v", mariaDB)
+	}
+}
@@ -0,0 +1,303 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	_jsonSmallObject = 0x00
+	_jsonLargeObject = 0x01
+	_jsonSmallArray  = 0x02
+	_jsonLargeArray  = 0x03
+	_jsonLiteral     = 0x04
+	_jsonInt16       = 0x05
+	_jsonUint16      = 0x06
+	_jsonInt32       = 0x07
+	_jsonUint32      = 0x08
+	_jsonInt64       = 0x09
+	_jsonUint64      = 0x0a
+	_jsonDouble      = 0x0b
+	_jsonString      = 0x0c
+	_jsonOpaque      = 0x0f
+
+	_jsonLiteralNull  = 0x00
+	_jsonLiteralTrue  = 0x01
+	_jsonLiteralFalse = 0x02
+)
+
+// Decodes the binary format MySQL uses to store JSON columns into the same
+// values encoding/json produces
+func decodeBinaryJSON(data []byte) (any, error) {
+	// Empty documents are written for JSON columns set to NULL by statements
+	// that ignore errors
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return decodeJSONValue(data[0], data[1:])
+}
+
+func decodeJSONValue(valueType byte, data []byte) (any, error) {
+	switch valueType {
+	case _jsonSmallObject:
+		return decodeJSONObject(data, 2)
+	case _jsonLargeObject:
+		return decodeJSONObject(data, 4)
+	case _jsonSmallArray:
+		return decodeJSONArray(data, 2)
+	case _jsonLargeArray:
+		return decodeJSONArray(data, 4)
+	case _jsonLiteral:
+		if len(data) == 0 {
+			return nil, fmt.Errorf("invalid binary JSON literal")
+		}
+
+		return decodeJSONLiteral(data[0])
+	case _jsonInt16:
+		value, err := jsonUint(data, 0, 2)
+		return float64(int16(value)), err
+	case _jsonUint16:
+		value, err := jsonUint(data, 0, 2)
+		return float64(value), err
+	case _jsonInt32:
+		value, err := jsonUint(data, 0, 4)
+		return float64(int32(value)), err
+	case _jsonUint32:
+		value, err := jsonUint(data, 0, 4)
+		return float64(value), err
+	case _jsonInt64:
+		value, err := jsonUint(data, 0, 8)
+		return float64(int64(value)), err
+	case _jsonUint64:
+		value, err := jsonUint(data, 0, 8)
+		return float64(value), err
+	case _jsonDouble:
+		value, err := jsonUint(data, 0, 8)
+		return math.Float64frombits(value), err
+	case _jsonString:
+		r := packetReader{data: data}
+		value := r.take(jsonVariableLength(&r))
+		return string(value), r.err
+	case _jsonOpaque:
+		return decodeJSONOpaque(data)
+	}
+
+	return nil, fmt.Errorf("unsupported binary JSON type %d", valueType)
+}
+
+func decodeJSONLiteral(literal byte) (any, error) {
+	switch literal {
+	case _jsonLiteralNull:
+		return nil, nil
+	case _jsonLiteralTrue:
+		return true, nil
+	case _jsonLiteralFalse:
+		return false, nil
+	}
+
+	return nil, fmt.Errorf("invalid binary JSON literal %d", literal)
+}
+
+// Objects start with the element count and size, followed by the key entries,
+// the value entries, the keys and the values. Every offset is relative to the
+// start of the object
+func decodeJSONObject(data []byte, size int) (any, error) {
+	count, err := jsonUint(data, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	keyEntriesOffset := 2 * size
+	valueEntriesOffset := keyEntriesOffset + int(count)*(size+2)
+
+	object := make(map[string]any, count)
+	for i := range int(count) {
+		keyEntry := keyEntriesOffset + i*(size+2)
+
+		keyOffset, err := jsonUint(data, keyEntry, size)
+		if err != nil {
+			return nil, err
+		}
+
+		keyLength, err := jsonUint(data, keyEntry+size, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if int(keyOffset+keyLength) > len(data) {
+			return nil, fmt.Errorf("invalid binary JSON key offset %d", keyOffset)
+		}
+
+		value, err := decodeJSONEntry(data, valueEntriesOffset+i*(size+1), size)
+		if err != nil {
+			return nil, err
+		}
+
+		object[string(data[keyOffset:keyOffset+keyLength])] = value
+	}
+
+	return object, nil
+}
+
+func decodeJSONArray(data []byte, size int) (any, error) {
+	count, err := jsonUint(data, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	array := make([]any, 0, count)
+	for i := range int(count) {
+		value, err := decodeJSONEntry(data, 2*size+i*(size+1), size)
+		if err != nil {
+			return nil, err
+		}
+
+		array = append(array, value)
+	}
+
+	return array, nil
+}
+
+// Small values are stored inline on the entry, every other one is stored at
+// the offset the entry points to
+func decodeJSONEntry(data []byte, entry int, size int) (any, error) {
+	if entry >= len(data) {
+		return nil, fmt.Errorf("invalid binary JSON entry offset %d", entry)
+	}
+
+	valueType := data[entry]
+
+	inline := valueType == _jsonLiteral || valueType == _jsonInt16 || valueType == _jsonUint16
+	if size == 4 {
+		inline = inline || valueType == _jsonInt32 || valueType == _jsonUint32
+	}
+
+	if inline {
+		if entry+1+size > len(data) {
+			return nil, fmt.Errorf("invalid binary JSON entry offset %d", entry)
+		}
+
+		return decodeJSONValue(valueType, data[entry+1:entry+1+size])
+	}
+
+	offset, err := jsonUint(data, entry+1, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if int(offset) >= len(data) {
+		return nil, fmt.Errorf("invalid binary JSON value offset %d", offset)
+	}
+
+	return decodeJSONValue(valueType, data[offset:])
+}
+
+// Opaque values keep the MySQL type of scalars JSON has no type for, such as
+// decimals and dates. Types that can not be converted are returned as base64
+func decodeJSONOpaque(data []byte) (any, error) {
+	r := packetReader{data: data}
+	columnType := r.byte()
+	value := r.take(jsonVariableLength(&r))
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	switch columnType {
+	case _mysqlTypeNewDecimal:
+		if len(value) < 2 {
+			return nil, fmt.Errorf("invalid binary JSON decimal")
+		}
+
+		decimal := packetReader{data: value[2:]}
+		number, err := strconv.ParseFloat(decodeDecimal(&decimal, int(value[0]), int(value[1])), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		return number, decimal.err
+
+	case _mysqlTypeDate, _mysqlTypeDatetime, _mysqlTypeTimestamp, _mysqlTypeTime:
+		if len(value) < 8 {
+			return nil, fmt.Errorf("invalid binary JSON temporal value")
+		}
+
+		return formatPackedTemporal(columnType, int64(binary.LittleEndian.Uint64(value))), nil
+	}
+
+	return base64.StdEncoding.EncodeToString(value), nil
+}
+
+// Temporal values of JSON documents are stored in the packed in memory format
+// of the server, with the fractional part on the lower 24 bits
+func formatPackedTemporal(columnType byte, packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+
+	integer := packed >> 24
+	microseconds := int(packed % (1 << 24))
+	fraction := ""
+	if microseconds != 0 {
+		fraction = fmt.Sprintf(".%06d", microseconds)
+	}
+
+	if columnType == _mysqlTypeTime {
+		return fmt.Sprintf(
+			"%s%02d:%02d:%02d%s",
+			sign,
+			(integer>>12)%(1<<10), (integer>>6)%(1<<6), integer%(1<<6),
+			fraction)
+	}
+
+	ymd := integer >> 17
+	ym := ymd >> 5
+	hms := integer % (1 << 17)
+
+	if columnType == _mysqlTypeDate {
+		return fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd%(1<<5))
+	}
+
+	return fmt.Sprintf(
+		"%04d-%02d-%02d %02d:%02d:%02d%s",
+		ym/13, ym%13, ymd%(1<<5),
+		hms>>12, (hms>>6)%(1<<6), hms%(1<<6),
+		fraction)
+}
+
+// Lengths of strings and opaque values use seven bits per byte, with the high
+// bit set on every byte but the last
+func jsonVariableLength(r *packetReader) int {
+	length := 0
+	for i := range 5 {
+		b := r.byte()
+		length |= int(b&0x7f) << (7 * i)
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	return length
+}
+
+// Reads a little endian integer of a binary JSON value
+func jsonUint(data []byte, offset int, size int) (uint64, error) {
+	if offset < 0 || offset+size > len(data) {
+		return 0, fmt.Errorf("invalid binary JSON offset %d", offset)
+	}
+
+	switch size {
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(data[offset:])), nil
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(data[offset:])), nil
+	}
+
+	return binary.LittleEndian.Uint64(data[offset:]), nil
+}
@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeBinaryJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected any
+	}{
+		{"empty document", []byte{}, nil},
+		{"null", []byte{_jsonLiteral, _jsonLiteralNull}, nil},
+		{"true", []byte{_jsonLiteral, _jsonLiteralTrue}, true},
+		{"int16", []byte{_jsonInt16, 0xfe, 0xff}, float64(-2)},
+		{"uint32", []byte{_jsonUint32, 0x00, 0x00, 0x00, 0x80}, float64(1 << 31)},
+		{"double", []byte{_jsonDouble, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f}, 1.5},
+		{"string", []byte{_jsonString, 0x03, 'a', 'b', 'c'}, "abc"},
+		{
+			// [1, "x"]
+			"small array",
+			[]byte{
+				_jsonSmallArray,
+				0x02, 0x00, // count
+				0x0c, 0x00, // size
+				_jsonInt16, 0x01, 0x00,
+				_jsonString, 0x0a, 0x00,
+				0x01, 'x',
+			},
+			[]any{float64(1), "x"},
+		},
+		{
+			// {"a": null, "bc": {"d": 7}}
+			"nested small objects",
+			[]byte{
+				_jsonSmallObject,
+				0x02, 0x00, // count
+				0x21, 0x00, // size
+				0x12, 0x00, 0x01, 0x00, // key "a"
+				0x13, 0x00, 0x02, 0x00, // key "bc"
+				_jsonLiteral, _jsonLiteralNull, 0x00,
+				_jsonSmallObject, 0x15, 0x00,
+				'a',
+				'b', 'c',
+				0x01, 0x00, 0x0c, 0x00, 0x0b, 0x00, 0x01, 0x00, _jsonInt16, 0x07, 0x00, 'd',
+			},
+			map[string]any{"a": nil, "bc": map[string]any{"d": float64(7)}},
+		},
+		{
+			// {"k": 70000}, where 32 bit integers are inlined
+			"large object",
+			[]byte{
+				_jsonLargeObject,
+				0x01, 0x00, 0x00, 0x00, // count
+				0x14, 0x00, 0x00, 0x00, // size
+				0x13, 0x00, 0x00, 0x00, 0x01, 0x00, // key "k"
+				_jsonInt32, 0x70, 0x11, 0x01, 0x00,
+				'k',
+			},
+			map[string]any{"k": float64(70000)},
+		},
+		{
+			"opaque decimal",
+			[]byte{_jsonOpaque, _mysqlTypeNewDecimal, 0x09, 0x0e, 0x04, 0x81, 0x0d, 0xfb, 0x38, 0xd2, 0x04, 0xd2},
+			1234567890.1234,
+		},
+		{
+			"opaque datetime",
+			[]byte{_jsonOpaque, _mysqlTypeDatetime, 0x08, 0x00, 0x00, 0x00, 0x1e, 0xa5, 0xde, 0xb2, 0x19},
+			"2024-03-15 10:20:30",
+		},
+		{
+			"opaque date",
+			[]byte{_jsonOpaque, _mysqlTypeDate, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0xde, 0xb2, 0x19},
+			"2024-03-15",
+		},
+		{"opaque binary", []byte{_jsonOpaque, _mysqlTypeBlob, 0x02, 0x01, 0x02}, "AQI="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := decodeBinaryJSON(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(value, test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, value)
+			}
+		})
+	}
+}
+
+func TestDecodeBinaryJSONInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"unknown type":       {0x0e},
+		"invalid literal":    {_jsonLiteral, 0x03},
+		"truncated object":   {_jsonSmallObject, 0x01, 0x00, 0x0b, 0x00},
+		"value out of range": {_jsonSmallArray, 0x01, 0x00, 0x07, 0x00, _jsonString, 0xff, 0x00},
+	}
+
+	for name, data := range tests {
+		if _, err := decodeBinaryJSON(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_mysqlTypeDecimal    = 0
+	_mysqlTypeTiny       = 1
+	_mysqlTypeShort      = 2
+	_mysqlTypeLong       = 3
+	_mysqlTypeFloat      = 4
+	_mysqlTypeDouble     = 5
+	_mysqlTypeNull       = 6
+	_mysqlTypeTimestamp  = 7
+	_mysqlTypeLongLong   = 8
+	_mysqlTypeInt24      = 9
+	_mysqlTypeDate       = 10
+	_mysqlTypeTime       = 11
+	_mysqlTypeDatetime   = 12
+	_mysqlTypeYear       = 13
+	_mysqlTypeVarchar    = 15
+	_mysqlTypeBit        = 16
+	_mysqlTypeTimestamp2 = 17
+	_mysqlTypeDatetime2  = 18
+	_mysqlTypeTime2      = 19
+	_mysqlTypeJSON       = 245
+	_mysqlTypeNewDecimal = 246
+	_mysqlTypeEnum       = 247
+	_mysqlTypeSet        = 248
+	_mysqlTypeBlob       = 252
+	_mysqlTypeVarString  = 253
+	_mysqlTypeString     = 254
+	_mysqlTypeGeometry   = 255
+)
+
+// The names and the details needed to decode some of the values, taken from
+// the table map metadata or read from information_schema
+type binlogColumn struct {
+	name     string
+	unsigned bool
+	binary   bool
+
+	// Values of enum and set columns, in declaration order
+	values []string
+}
+
+func newBinlogColumn(name string, dataType string, columnType string) binlogColumn {
+	column := binlogColumn{
+		name:     name,
+		unsigned: strings.Contains(columnType, "unsigned"),
+	}
+
+	switch strings.ToLower(dataType) {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob",
+		"geometry", "point", "linestring", "polygon", "multipoint", "multilinestring",
+		"multipolygon", "geometrycollection", "geomcollection":
+		column.binary = true
+	case "enum", "set":
+		column.values = parseEnumValues(columnType)
+	}
+
+	return column
+}
+
+// Parses the values of a column type such as enum('a','b'), where quotes
+// inside the values are doubled
+func parseEnumValues(columnType string) []string {
+	start, end := strings.IndexByte(columnType, '('), strings.LastIndexByte(columnType, ')')
+	if start < 0 || end <= start {
+		return nil
+	}
+
+	list := columnType[start+1 : end]
+
+	var values []string
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case quoted && c == '\'' && i+1 < len(list) && list[i+1] == '\'':
+			value.WriteByte(c)
+			i++
+		case quoted && c == '\'':
+			quoted = false
+			values = append(values, value.String())
+			value.Reset()
+		case c == '\'':
+			quoted = true
+		case quoted:
+			value.WriteByte(c)
+		}
+	}
+
+	return values
+}
+
+// Values are decoded to the same types the trigger based listener produces:
+// numbers as float64, temporal values as strings in the MySQL format and
+// binary values as base64 strings
+func decodeBinlogValue(r *packetReader, columnType byte, meta uint16, column binlogColumn) any {
+	switch columnType {
+	case _mysqlTypeTiny:
+		if column.unsigned {
+			return float64(r.byte())
+		}
+
+		return float64(int8(r.byte()))
+
+	case _mysqlTypeShort:
+		if column.unsigned {
+			return float64(r.uint16())
+		}
+
+		return float64(int16(r.uint16()))
+
+	case _mysqlTypeInt24:
+		value := r.uint24()
+		if column.unsigned {
+			return float64(value)
+		}
+
+		return float64(int32(value<<8) >> 8)
+
+	case _mysqlTypeLong:
+		if column.unsigned {
+			return float64(r.uint32())
+		}
+
+		return float64(int32(r.uint32()))
+
+	case _mysqlTypeLongLong:
+		if column.unsigned {
+			return float64(r.uint64())
+		}
+
+		return float64(int64(r.uint64()))
+
+	case _mysqlTypeFloat:
+		return float64(math.Float32frombits(r.uint32()))
+
+	case _mysqlTypeDouble:
+		return math.Float64frombits(r.uint64())
+
+	case _mysqlTypeNewDecimal:
+		value, err := strconv.ParseFloat(decodeDecimal(r, int(meta>>8), int(meta&0xff)), 64)
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+
+		return value
+
+	case _mysqlTypeYear:
+		year := r.byte()
+		if year == 0 {
+			return float64(0)
+		}
+
+		return float64(1900 + int(year))
+
+	case _mysqlTypeDate:
+		value := r.uint24()
+		return fmt.Sprintf("%04d-%02d-%02d", value>>9, (value>>5)&15, value&31)
+
+	case _mysqlTypeTime:
+		value := r.uint24()
+		return fmt.Sprintf("%02d:%02d:%02d", value/10000, (value%10000)/100, value%100)
+
+	case _mysqlTypeDatetime:
+		value := r.uint64()
+		date, clock := value/1000000, value%1000000
+		return fmt.Sprintf(
+			"%04d-%02d-%02d %02d:%02d:%02d",
+			date/10000, (date%10000)/100, date%100,
+			clock/10000, (clock%10000)/100, clock%100)
+
+	case _mysqlTypeTimestamp:
+		return formatTimestamp(int64(r.uint32()), 0, 0)
+
+	case _mysqlTypeTimestamp2:
+		seconds := int64(readBigEndian(r, 4))
+		return formatTimestamp(seconds, readFraction(r, int(meta)), int(meta))
+
+	case _mysqlTypeDatetime2:
+		return decodeDatetime2(r, int(meta))
+
+	case _mysqlTypeTime2:
+		return decodeTime2(r, int(meta))
+
+	case _mysqlTypeBit:
+		length := (int(meta>>8)*8 + int(meta&0xff) + 7) / 8
+		return float64(readBigEndian(r, length))
+
+	case _mysqlTypeVarchar, _mysqlTypeVarString:
+		return decodeString(r, int(meta), column)
+
+	case _mysqlTypeString:
+		realType, length := byte(meta>>8), int(meta&0xff)
+		if realType&0x30 != 0x30 {
+			length |= int((realType&0x30)^0x30) << 4
+			realType |= 0x30
+		}
+
+		switch realType {
+		case _mysqlTypeEnum:
+			return decodeEnum(int(r.uintN(length)), column)
+		case _mysqlTypeSet:
+			return decodeSet(r.uintN(length), column)
+		}
+
+		return decodeString(r, length, column)
+
+	case _mysqlTypeBlob, _mysqlTypeGeometry:
+		data := r.take(int(r.uintN(int(meta))))
+		if column.binary {
+			return base64.StdEncoding.EncodeToString(data)
+		}
+
+		return string(data)
+
+	case _mysqlTypeJSON:
+		data := r.take(int(r.uintN(int(meta))))
+		value, err := decodeBinaryJSON(data)
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+
+		return value
+	}
+
+	if r.err == nil {
+		r.err = fmt.Errorf("unsupported binlog column type %d on column [%s]", columnType, column.name)
+	}
+
+	return nil
+}
+
+// Strings longer than 255 bytes have a two byte length prefix
+func decodeString(r *packetReader, maxLength int, column binlogColumn) any {
+	prefix := 1
+	if maxLength > 255 {
+		prefix = 2
+	}
+
+	data := r.take(int(r.uintN(prefix)))
+	if column.binary {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	return string(data)
+}
+
+func decodeEnum(index int, column binlogColumn) any {
+	if index == 0 || index > len(column.values) {
+		return ""
+	}
+
+	return column.values[index-1]
+}
+
+func decodeSet(bitmap uint64, column binlogColumn) any {
+	var values []string
+	for i, value := range column.values {
+		if bitmap&(1<<i) != 0 {
+			values = append(values, value)
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+func readBigEndian(r *packetReader, n int) uint64 {
+	var value uint64
+	for _, b := range r.take(n) {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+// Returns the fractional seconds, stored with one byte for every two digits
+// of precision
+func readFraction(r *packetReader, precision int) int {
+	switch precision {
+	case 1, 2:
+		return int(readBigEndian(r, 1)) * 10000
+	case 3, 4:
+		return int(readBigEndian(r, 2)) * 100
+	case 5, 6:
+		return int(readBigEndian(r, 3))
+	}
+
+	return 0
+}
+
+func formatTimestamp(seconds int64, microseconds int, precision int) string {
+	if seconds == 0 && microseconds == 0 {
+		return "0000-00-00 00:00:00" + formatFraction(0, precision)
+	}
+
+	t := time.Unix(seconds, int64(microseconds)*1000).UTC()
+	return t.Format(time.DateTime) + formatFraction(microseconds, precision)
+}
+
+func formatFraction(microseconds int, precision int) string {
+	if precision == 0 {
+		return ""
+	}
+
+	return "." + fmt.Sprintf("%06d", microseconds)[:precision]
+}
+
+func decodeDatetime2(r *packetReader, precision int) string {
+	value := int64(readBigEndian(r, 5)) - 0x8000000000
+	microseconds := readFraction(r, precision)
+
+	ymd := value >> 17
+	ym := ymd >> 5
+	hms := value % (1 << 17)
+
+	return fmt.Sprintf(
+		"%04d-%02d-%02d %02d:%02d:%02d",
+		ym/13, ym%13, ymd%(1<<5),
+		hms>>12, (hms>>6)%(1<<6), hms%(1<<6)) + formatFraction(microseconds, precision)
+}
+
+// Negative times store the fraction as its complement, which is undone
+// before joining both parts into a single packed value
+func decodeTime2(r *packetReader, precision int) string {
+	var packed int64
+	switch precision {
+	case 1, 2, 3, 4:
+		size, scale := 1, int64(10000)
+		if precision > 2 {
+			size, scale = 2, 100
+		}
+
+		integer := int64(readBigEndian(r, 3)) - 0x800000
+		fraction := int64(readBigEndian(r, size))
+		if integer < 0 && fraction != 0 {
+			integer++
+			fraction -= 1 << (8 * size)
+		}
+
+		packed = integer<<24 + fraction*scale
+
+	case 5, 6:
+		packed = int64(readBigEndian(r, 6)) - 0x800000000000
+
+	default:
+		packed = (int64(readBigEndian(r, 3)) - 0x800000) << 24
+	}
+
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+
+	hms := packed >> 24
+	microseconds := int(packed % (1 << 24))
+
+	return fmt.Sprintf(
+		"%s%02d:%02d:%02d",
+		sign,
+		(hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6)) + formatFraction(microseconds, precision)
+}
+
+// Decimals are stored as groups of nine digits in four bytes, with the
+// leftover digits of each side in as few bytes as they fit. Negative values
+// have every bit inverted, and the sign is kept on the first bit
+func decodeDecimal(r *packetReader, precision int, scale int) string {
+	compressedBytes := [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+	integral := precision - scale
+	fullIntegral, leftIntegral := integral/9, integral%9
+	fullFractional, leftFractional := scale/9, scale%9
+
+	size := fullIntegral*4 + compressedBytes[leftIntegral] + fullFractional*4 + compressedBytes[leftFractional]
+	data := append([]byte(nil), r.take(size)...)
+	if len(data) == 0 {
+		return "0"
+	}
+
+	negative := data[0]&0x80 == 0
+	data[0] ^= 0x80
+	if negative {
+		for i := range data {
+			data[i] ^= 0xff
+		}
+	}
+
+	offset := 0
+	group := func(n int) uint64 {
+		var value uint64
+		for _, b := range data[offset : offset+n] {
+			value = value<<8 | uint64(b)
+		}
+
+		offset += n
+		return value
+	}
+
+	var decimal strings.Builder
+	if negative {
+		decimal.WriteByte('-')
+	}
+
+	var integralDigits strings.Builder
+	integralDigits.WriteString(strconv.FormatUint(group(compressedBytes[leftIntegral]), 10))
+	for range fullIntegral {
+		fmt.Fprintf(&integralDigits, "%09d", group(4))
+	}
+
+	// Full groups are zero padded, which leaves leading zeros on values
+	// shorter than the column precision
+	integralPart := strings.TrimLeft(integralDigits.String(), "0")
+	if integralPart == "" {
+		integralPart = "0"
+	}
+
+	decimal.WriteString(integralPart)
+
+	if scale > 0 {
+		decimal.WriteByte('.')
+		for range fullFractional {
+			fmt.Fprintf(&decimal, "%09d", group(4))
+		}
+
+		if leftFractional > 0 {
+			fmt.Fprintf(&decimal, "%0*d", leftFractional, group(compressedBytes[leftFractional]))
+		}
+	}
+
+	return decimal.String()
+}
@@ -0,0 +1,100 @@
+package mysql
+
+import "testing"
+
+func TestDecodeDecimal(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision int
+		scale     int
+		data      []byte
+		expected  string
+	}{
+		{"full and leftover groups", 14, 4, []byte{0x81, 0x0d, 0xfb, 0x38, 0xd2, 0x04, 0xd2}, "1234567890.1234"},
+		{"negative", 14, 4, []byte{0x7e, 0xf2, 0x04, 0xc7, 0x2d, 0xfb, 0x2d}, "-1234567890.1234"},
+		{"short value", 14, 4, []byte{0x80, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00}, "5.0000"},
+		{"leftover groups only", 5, 2, []byte{0x80, 0x7b, 0x2d}, "123.45"},
+		{"negative leftover groups only", 5, 2, []byte{0x7f, 0x84, 0xd2}, "-123.45"},
+		{"fraction leading zeros", 4, 2, []byte{0x81, 0x05}, "1.05"},
+		{"no fraction", 10, 0, []byte{0x80, 0x00, 0x00, 0x00, 0x00}, "0"},
+		{"no integral part", 3, 3, []byte{0x80, 0x01}, "0.001"},
+		{"full fraction group", 10, 9, []byte{0x87, 0x07, 0x5b, 0xcd, 0x15}, "7.123456789"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := packetReader{data: test.data}
+			decimal := decodeDecimal(&r, test.precision, test.scale)
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+
+			if decimal != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, decimal)
+			}
+
+			if r.remaining() != 0 {
+				t.Errorf("expected every byte to be read, %d left", r.remaining())
+			}
+		})
+	}
+}
+
+func TestDecodeDatetime2(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision int
+		data      []byte
+		expected  string
+	}{
+		{"seconds", 0, []byte{0x99, 0xb2, 0xde, 0xa5, 0x1e}, "2024-03-15 10:20:30"},
+		{"milliseconds", 3, []byte{0x99, 0xb2, 0xde, 0xa5, 0x1e, 0x04, 0xce}, "2024-03-15 10:20:30.123"},
+		{"microseconds", 6, []byte{0x99, 0xb2, 0xde, 0xa5, 0x1e, 0x01, 0xe2, 0x40}, "2024-03-15 10:20:30.123456"},
+		{"zero date", 0, []byte{0x80, 0x00, 0x00, 0x00, 0x00}, "0000-00-00 00:00:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := packetReader{data: test.data}
+			datetime := decodeDatetime2(&r, test.precision)
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+
+			if datetime != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, datetime)
+			}
+		})
+	}
+}
+
+func TestDecodeTime2(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision int
+		data      []byte
+		expected  string
+	}{
+		{"seconds", 0, []byte{0x80, 0xc8, 0xb8}, "12:34:56"},
+		{"negative", 0, []byte{0x4b, 0x91, 0x05}, "-838:59:59"},
+		{"tenths", 1, []byte{0x80, 0xc8, 0xb8, 0x0a}, "12:34:56.1"},
+		{"negative tenths", 1, []byte{0x7f, 0xff, 0xfe, 0xce}, "-00:00:01.5"},
+		{"negative milliseconds", 3, []byte{0x7f, 0xff, 0xfe, 0xec, 0x78}, "-00:00:01.500"},
+		{"microseconds", 6, []byte{0x80, 0x10, 0x83, 0x06, 0xf8, 0x55}, "01:02:03.456789"},
+		{"negative microseconds", 6, []byte{0x7f, 0xff, 0xfe, 0xf8, 0x5e, 0xe0}, "-00:00:01.500000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := packetReader{data: test.data}
+			value := decodeTime2(&r, test.precision)
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+
+			if value != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package mysql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+const (
+	OperationInsert = event.OpInsert
+	OperationUpdate = event.OpUpdate
+	OperationDelete = event.OpDelete
+)
+
+type Table struct {
+	Name           string   `yaml:"name"`
+	ChangedColumns bool     `yaml:"changedColumns"`
+	Operations     []string `yaml:"operations"`
+
+	// Discovered from the database on setup, not configured
+	schema     string
+	relation   string
+	primaryKey []string
+}
+
+// Allows tables to be declared both as plain names and as objects with
+// per-table options
+func (t *Table) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := unmarshal(&t.Name); err == nil {
+		return nil
+	}
+
+	type table Table
+	return unmarshal((*table)(t))
+}
+
+// Splits the table name into its database and table name, the database is
+// empty if the name is not qualified and is the database of the DSN
+func (t *Table) SchemaAndRelation() (string, string) {
+	schema, relation, qualified := strings.Cut(t.Name, ".")
+	if !qualified {
+		return "", t.Name
+	}
+
+	return schema, relation
+}
+
+func (t *Table) Validate() error {
+	parts := strings.Split(t.Name, ".")
+	if len(parts) > 2 || slices.Contains(parts, "") {
+		return fmt.Errorf("invalid table name [%s], expected [table] or [database.table]", t.Name)
+	}
+
+	for _, operation := range t.Operations {
+		switch operation {
+		case OperationInsert, OperationUpdate, OperationDelete:
+			continue
+		}
+
+		return fmt.Errorf(
+			"invalid operation [%s] for table [%s], expected one of: [%s, %s, %s]",
+			operation,
+			t.Name,
+			OperationInsert,
+			OperationUpdate,
+			OperationDelete)
+	}
+
+	return nil
+}
+
+func (t *Table) OperationsOrDefault() []string {
+	if len(t.Operations) == 0 {
+		return []string{OperationInsert, OperationUpdate, OperationDelete}
+	}
+
+	return t.Operations
+}
+
+// Options of the binlog input, which connects to the server as a replica
+type BinlogConfig struct {
+	ServerID            uint32 `yaml:"serverId"`
+	HeartbeatSeconds    uint64 `yaml:"heartbeatSeconds"`
+	ColumnsFromDatabase bool   `yaml:"columnsFromDatabase"`
+}
+
+// Every replica of a server must have a distinct id, so the default one is
+// derived from the host and the name prefix instead of being fixed
+func (bc *BinlogConfig) ServerIDOrDefault(namePrefix string) uint32 {
+	if bc.ServerID != 0 {
+		return bc.ServerID
+	}
+
+	hostname, _ := os.Hostname()
+
+	hash := fnv.New32a()
+	hash.Write([]byte(hostname + "/" + namePrefix))
+
+	return hash.Sum32() | 1<<31
+}
+
+func (bc *BinlogConfig) HeartbeatSecondsOrDefault() time.Duration {
+	if bc.HeartbeatSeconds == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(bc.HeartbeatSeconds) * time.Second
+}
+
+type Config struct {
+	TimeoutSeconds uint64       `yaml:"timeoutSeconds"`
+	PollSeconds    uint64       `yaml:"pollSeconds"`
+	PollLimit      uint64       `yaml:"pollLimit"`
+	DSN            string       `yaml:"dsn"`
+	Tables         []Table      `yaml:"tables"`
+	EventTable     string       `yaml:"eventTable"`
+	NamePrefix     string       `yaml:"namePrefix"`
+	Binlog         BinlogConfig `yaml:"binlog"`
+}
+
+func (c *Config) TimeoutSecondsOrDefault() time.Duration {
+	if c.TimeoutSeconds == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+func (c *Config) PollSecondsOrDefault() time.Duration {
+	if c.PollSeconds == 0 {
+		return 5 * time.Second
+	}
+
+	return time.Duration(c.PollSeconds) * time.Second
+}
+
+func (c *Config) LimitOrDefault() uint64 {
+	if c.PollLimit == 0 {
+		return 50
+	}
+
+	return c.PollLimit
+}
+
+func (c *Config) NamePrefixOrDefault() string {
+	if c.NamePrefix == "" {
+		return "from_to_"
+	}
+
+	return c.NamePrefix
+}
+
+func (c *Config) EventTableOrDefault() string {
+	if c.EventTable == "" {
+		return c.NamePrefixOrDefault() + "event"
+	}
+
+	return c.EventTable
+}
@@ -0,0 +1,32 @@
+package mysql
+
+import (
+	"database/sql"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+// Timestamps are always parsed, as the event table has them regardless of
+// the DSN options. The parsed DSN is returned for the connectors that open
+// their own connections
+func openDatabase(dsn string) (*sql.DB, *gomysql.Config, error) {
+	config, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config.ParseTime = true
+
+	connector, err := gomysql.NewConnector(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db := sql.OpenDB(connector)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return db, config, nil
+}
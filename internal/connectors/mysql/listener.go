@@ -0,0 +1,270 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/connectors/eventtable"
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+// Captures changes with triggers that write them to an event table, which is
+// polled for unsent events. A single instance is expected per event table
+type Listener struct {
+	limit                  uint64
+	waitSeconds            time.Duration
+	timeout                time.Duration
+	db                     *sql.DB
+	logger                 *slog.Logger
+	tableToChannelRelation map[string][]event.Channel
+	tables                 map[string]Table
+	names                  objectNames
+	ledger                 eventtable.Ledger
+}
+
+func NewListener(config Config, channels map[string]event.Channel) (*Listener, error) {
+	listener := &Listener{
+		limit:       config.LimitOrDefault(),
+		waitSeconds: config.PollSecondsOrDefault(),
+		timeout:     config.TimeoutSecondsOrDefault(),
+		logger:      slog.With("listener", "MySQL"),
+		tables:      make(map[string]Table, len(config.Tables)),
+	}
+
+	for _, table := range config.Tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if event.UsesTransactionMarkers(channels) {
+		listener.logger.Warn("Transaction markers are only supported by the postgres inputs, ignoring")
+	}
+
+	if err := listener.connectToDatabase(config.DSN); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupDatabaseSchema(config, channels); err != nil {
+		return nil, err
+	}
+
+	listener.ledger = eventtable.Ledger{
+		DB:      listener.db,
+		Timeout: listener.timeout,
+		Logger:  listener.logger,
+		DeliveredChannelsQuery: func(ids []uint64) (string, []any) {
+			return eventtable.IDListQuery(listener.names.render(getDeliveredChannelsPartialQuery), ids)
+		},
+		SetEventsAsSentQuery: func(ids []uint64) (string, []any) {
+			return eventtable.IDListQuery(listener.names.render(setEventsAsSentPartialQuery), ids)
+		},
+		SaveDeliveryQuery: listener.names.render(saveDeliveryQuery),
+	}
+
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
+	listener.logger.Info("Connector setup completed")
+
+	return listener, nil
+}
+
+// Polls the event table until ctx is done, the batch being published when ctx
+// is done is finished before returning
+func (l *Listener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	for {
+		if err := l.processUnsentEvents(ctx, callback); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			l.logger.Info("Listener stopped")
+			return nil
+
+		case <-time.After(l.waitSeconds):
+			l.logger.Debug("Polling for new unsent events")
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return l.db.Close()
+}
+
+func (l *Listener) WriteDeadLetter(ctx context.Context, deadLetter event.DeadLetter) error {
+	return eventtable.WriteDeadLetter(ctx, l.db, l.names.render(insertDeadLetterQuery), l.timeout, deadLetter)
+}
+
+func (l *Listener) connectToDatabase(dsn string) error {
+	db, config, err := openDatabase(dsn)
+	if err != nil {
+		return err
+	}
+
+	l.db = db
+
+	l.logger.Debug("Connected to database", "addr", config.Addr, "database", config.DBName)
+	return nil
+}
+
+func (l *Listener) setupDatabaseSchema(config Config, channels map[string]event.Channel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var database sql.NullString
+	if err := l.db.QueryRowContext(ctx, getCurrentDatabaseQuery).Scan(&database); err != nil {
+		return err
+	}
+
+	if database.String == "" {
+		return errors.New("the DSN does not select a database, it is required to create the event table")
+	}
+
+	l.names = newObjectNames(config, database.String)
+
+	queries := []string{
+		setupFromToEventTableQuery,
+		setupFromToEventDeliveryTableQuery,
+	}
+
+	if event.UsesDeadLetterTable(channels) {
+		queries = append(queries, setupFromToDeadLetterTableQuery)
+	}
+
+	for _, query := range queries {
+		if _, err := l.db.ExecContext(ctx, l.names.render(query)); err != nil {
+			return err
+		}
+	}
+
+	l.logger.Debug("Event table setup complete")
+
+	for _, table := range config.Tables {
+		table.schema, table.relation = table.SchemaAndRelation()
+		if table.schema == "" {
+			table.schema = database.String
+		}
+
+		if err := l.setupTableTrigger(ctx, table); err != nil {
+			return err
+		}
+
+		primaryKey, err := getPrimaryKeyColumns(ctx, l.db, table)
+		if err != nil {
+			return err
+		}
+
+		if len(primaryKey) == 0 {
+			l.logger.Debug("Table does not have a primary key, its events have no key", "table", table.Name)
+		}
+
+		table.primaryKey = primaryKey
+		l.tables[table.Name] = table
+
+		l.logger.Debug("Table setup complete", "table", table.Name)
+	}
+
+	return nil
+}
+
+func (l *Listener) processUnsentEvents(
+	ctx context.Context,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	for ctx.Err() == nil {
+		batchCtx := context.WithoutCancel(ctx)
+
+		events, err := l.getEventsToSend(batchCtx)
+		if err != nil {
+			return err
+		}
+
+		if len(events) > 0 {
+			l.logger.Info(fmt.Sprintf("Processing %d events", len(events)))
+		}
+
+		allDone, err := l.ledger.PublishBatch(batchCtx, events, l.tableToChannelRelation, callback)
+		if err != nil {
+			return err
+		}
+
+		// Only sleep once the event table was drained, or when some event is
+		// waiting to be retried
+		if !allDone || uint64(len(events)) < l.limit {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Events are returned by id, so the changes of a row always come in the order
+// they were committed
+func (l *Listener) getEventsToSend(ctx context.Context) ([]event.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	rows, err := l.db.QueryContext(ctx, l.names.render(getEventsToSendQuery), l.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []event.Event
+	for rows.Next() {
+		var e event.Event
+		var data, before []byte
+		var timestamp sql.NullTime
+		err := rows.Scan(
+			&e.ID,
+			&e.Op,
+			&e.Schema,
+			&e.Table,
+			&data,
+			&before,
+			&e.Ts,
+			&timestamp,
+			&e.Sent)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Timestamp = timestamp.Time
+		table := tableForEvent(l.tables, e)
+
+		if err := json.Unmarshal(data, &e.Row); err != nil {
+			return nil, err
+		}
+
+		e.Key = event.KeyFromRow(table.primaryKey, e.Row)
+
+		if before != nil {
+			if err := json.Unmarshal(before, &e.Before); err != nil {
+				return nil, err
+			}
+
+			if table.ChangedColumns {
+				e.Changed = event.ChangedColumns(e.Before, e.Row)
+			}
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// Tables may be declared with either the database qualified name or the bare
+// table name, the qualified name takes precedence
+func tableForEvent(tables map[string]Table, e event.Event) Table {
+	if table, ok := tables[e.QualifiedTable()]; ok {
+		return table
+	}
+
+	return tables[e.Table]
+}
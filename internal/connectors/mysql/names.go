@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Longest identifier accepted by MySQL
+const _maxIdentifierLength = 64
+
+// Names of the objects created on the database. They are qualified by the
+// database of the DSN, so triggers of tables on other databases still write
+// to the same event table
+type objectNames struct {
+	database   string
+	prefix     string
+	eventTable string
+	replacer   *strings.Replacer
+}
+
+func newObjectNames(config Config, database string) objectNames {
+	names := objectNames{
+		database:   database,
+		prefix:     config.NamePrefixOrDefault(),
+		eventTable: config.EventTableOrDefault(),
+	}
+
+	names.replacer = strings.NewReplacer(
+		"{{event}}", names.qualify(names.eventTable),
+		"{{delivery}}", names.qualify(names.eventTable+"_delivery"),
+		"{{dead_letter}}", names.qualify(names.prefix+"dead_letter"),
+		"{{binlog_checkpoint}}", names.qualify(names.prefix+"binlog_checkpoint"),
+	)
+
+	return names
+}
+
+// Replaces the object name placeholders of the query
+func (n *objectNames) render(query string) string {
+	return n.replacer.Replace(query)
+}
+
+func (n *objectNames) qualify(name string) string {
+	return quoteIdentifier(n.database) + "." + quoteIdentifier(name)
+}
+
+// Names longer than MySQL accepts are shortened with a hash of the full name,
+// so they stay distinct
+func (n *objectNames) triggerName(operation string, relation string) string {
+	name := n.prefix + strings.ToLower(_triggerEvents[operation]) + "_" + relation + "_trigger"
+	if len(name) <= _maxIdentifierLength {
+		return name
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+
+	return fmt.Sprintf("%s_%08x", name[:_maxIdentifierLength-9], hash.Sum32())
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "'", "''")
+
+	return "'" + value + "'"
+}
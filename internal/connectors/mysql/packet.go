@@ -0,0 +1,139 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Reads the little endian values of MySQL packets and binlog events, the
+// first error is kept and every later read returns zero values
+type packetReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *packetReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || r.offset+n > len(r.data) {
+		r.err = errors.New("unexpected end of MySQL packet")
+		return nil
+	}
+
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+
+	return b
+}
+
+func (r *packetReader) rest() []byte {
+	return r.take(len(r.data) - r.offset)
+}
+
+func (r *packetReader) remaining() int {
+	return len(r.data) - r.offset
+}
+
+func (r *packetReader) byte() byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (r *packetReader) uint16() uint16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *packetReader) uint24() uint32 {
+	b := r.take(3)
+	if b == nil {
+		return 0
+	}
+
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func (r *packetReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *packetReader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint64(b)
+}
+
+// Reads an unsigned integer of n bytes, used by table ids and length prefixes
+func (r *packetReader) uintN(n int) uint64 {
+	b := r.take(n)
+
+	var value uint64
+	for i, v := range b {
+		value |= uint64(v) << (8 * i)
+	}
+
+	return value
+}
+
+func (r *packetReader) lengthEncodedInt() uint64 {
+	switch first := r.byte(); first {
+	case 0xfc:
+		return uint64(r.uint16())
+	case 0xfd:
+		return uint64(r.uint24())
+	case 0xfe:
+		return r.uint64()
+	default:
+		return uint64(first)
+	}
+}
+
+// Reads a NUL terminated string, or the rest of the packet if there is no
+// terminator, as some servers omit the last one
+func (r *packetReader) nulString() string {
+	if r.err != nil {
+		return ""
+	}
+
+	end := bytes.IndexByte(r.data[r.offset:], 0)
+	if end < 0 {
+		return string(r.rest())
+	}
+
+	s := string(r.data[r.offset : r.offset+end])
+	r.offset += end + 1
+
+	return s
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(b, v)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(b, v)
+}
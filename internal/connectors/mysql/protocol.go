@@ -0,0 +1,450 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	_maxPacketSize = 1<<24 - 1
+
+	_clientLongPassword     = 0x00000001
+	_clientLongFlag         = 0x00000004
+	_clientProtocol41       = 0x00000200
+	_clientSSL              = 0x00000800
+	_clientTransactions     = 0x00002000
+	_clientSecureConnection = 0x00008000
+	_clientPluginAuth       = 0x00080000
+
+	_utf8mb4GeneralCICollation = 45
+
+	_comQuery          = 0x03
+	_comBinlogDump     = 0x12
+	_comBinlogDumpGTID = 0x1e
+
+	_binlogThroughGTID = 0x04
+
+	_packetOK              = 0x00
+	_packetAuthMoreData    = 0x01
+	_packetEOF             = 0xfe
+	_packetAuthSwitch      = 0xfe
+	_packetErr             = 0xff
+	_cachingSha2FastAuthOK = 0x03
+	_cachingSha2FullAuth   = 0x04
+	_cachingSha2PublicKey  = 0x02
+
+	_nativePasswordPlugin      = "mysql_native_password"
+	_cachingSha2PasswordPlugin = "caching_sha2_password"
+)
+
+// Minimal client of the MySQL protocol, enough to authenticate and read the
+// binlog as a replica, which the database/sql driver does not support
+type binlogConn struct {
+	conn        net.Conn
+	sequence    byte
+	readTimeout time.Duration
+
+	// Set once the connection switched to TLS
+	secure bool
+}
+
+func dialBinlogConn(network string, address string, timeout time.Duration, readTimeout time.Duration) (*binlogConn, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &binlogConn{
+		conn:        conn,
+		readTimeout: readTimeout,
+	}, nil
+}
+
+func (c *binlogConn) Close() error {
+	return c.conn.Close()
+}
+
+// Reads a whole packet, joining the packets that were split because they
+// exceed the maximum packet size
+func (c *binlogConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return nil, err
+		}
+
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return nil, err
+		}
+
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.sequence = header[3] + 1
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.conn, data); err != nil {
+			return nil, err
+		}
+
+		payload = append(payload, data...)
+		if length < _maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+func (c *binlogConn) writePacket(payload []byte) error {
+	packet := make([]byte, 4, 4+len(payload))
+	packet[0] = byte(len(payload))
+	packet[1] = byte(len(payload) >> 8)
+	packet[2] = byte(len(payload) >> 16)
+	packet[3] = c.sequence
+	packet = append(packet, payload...)
+
+	c.sequence++
+
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// Answers the server greeting, supporting the mysql_native_password and
+// caching_sha2_password plugins. With a TLS config the connection switches to
+// TLS before sending the credentials, as the database/sql driver does, and
+// only falls back to plain text if allowed. Without TLS the full
+// caching_sha2_password authentication encrypts the password with the server
+// RSA public key
+func (c *binlogConn) authenticate(user string, password string, tlsConfig *tls.Config, allowPlaintext bool) error {
+	greeting, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	if len(greeting) > 0 && greeting[0] == _packetErr {
+		return parseErrPacket(greeting)
+	}
+
+	r := packetReader{data: greeting}
+	if version := r.byte(); version != 10 {
+		return fmt.Errorf("unsupported MySQL protocol version %d", version)
+	}
+
+	r.nulString() // Server version
+	r.take(4)     // Connection id
+	scramble := bytes.Clone(r.take(8))
+	r.take(1)
+	capabilities := uint32(r.uint16())
+	r.take(3) // Character set and status flags
+	capabilities |= uint32(r.uint16()) << 16
+	authDataLength := int(r.byte())
+	r.take(10)
+
+	if capabilities&_clientSecureConnection != 0 {
+		part := r.take(max(13, authDataLength-8))
+		scramble = append(scramble, bytes.TrimRight(part, "\x00")...)
+	}
+
+	plugin := _nativePasswordPlugin
+	if capabilities&_clientPluginAuth != 0 {
+		plugin = r.nulString()
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	if tlsConfig != nil && capabilities&_clientSSL == 0 {
+		if !allowPlaintext {
+			return errors.New("the DSN requires TLS, but the server does not support it")
+		}
+
+		tlsConfig = nil
+	}
+
+	authResponse, err := scramblePassword(plugin, password, scramble)
+	if err != nil {
+		return err
+	}
+
+	flags := uint32(_clientLongPassword | _clientLongFlag | _clientProtocol41 |
+		_clientTransactions | _clientSecureConnection | _clientPluginAuth)
+	if tlsConfig != nil {
+		flags |= _clientSSL
+	}
+
+	response := appendUint32(nil, flags)
+	response = appendUint32(response, _maxPacketSize)
+	response = append(response, _utf8mb4GeneralCICollation)
+	response = append(response, make([]byte, 23)...)
+
+	// The SSL request is the start of the handshake response, which is sent
+	// again in full over TLS
+	if tlsConfig != nil {
+		if err := c.writePacket(response); err != nil {
+			return err
+		}
+
+		conn := tls.Client(c.conn, tlsConfig)
+		if err := conn.Handshake(); err != nil {
+			return err
+		}
+
+		c.conn = conn
+		c.secure = true
+	}
+
+	response = append(append(response, user...), 0)
+	response = append(append(response, byte(len(authResponse))), authResponse...)
+	response = append(append(response, plugin...), 0)
+
+	if err := c.writePacket(response); err != nil {
+		return err
+	}
+
+	return c.finishAuthentication(plugin, password, scramble)
+}
+
+func (c *binlogConn) finishAuthentication(plugin string, password string, scramble []byte) error {
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+
+		if len(packet) == 0 {
+			return errors.New("received an empty packet while authenticating")
+		}
+
+		switch packet[0] {
+		case _packetOK:
+			return nil
+
+		case _packetErr:
+			return parseErrPacket(packet)
+
+		case _packetAuthSwitch:
+			r := packetReader{data: packet[1:]}
+			plugin = r.nulString()
+			scramble = bytes.TrimRight(r.rest(), "\x00")
+
+			authResponse, err := scramblePassword(plugin, password, scramble)
+			if err != nil {
+				return err
+			}
+
+			if err := c.writePacket(authResponse); err != nil {
+				return err
+			}
+
+		case _packetAuthMoreData:
+			if plugin != _cachingSha2PasswordPlugin || len(packet) < 2 {
+				return fmt.Errorf("unexpected authentication data for plugin [%s]", plugin)
+			}
+
+			switch packet[1] {
+			case _cachingSha2FastAuthOK:
+				continue
+
+			case _cachingSha2FullAuth:
+				if err := c.sendEncryptedPassword(password, scramble); err != nil {
+					return err
+				}
+
+			default:
+				return fmt.Errorf("unexpected caching_sha2_password state %d", packet[1])
+			}
+
+		default:
+			return fmt.Errorf("unexpected packet 0x%02x while authenticating", packet[0])
+		}
+	}
+}
+
+// The password is sent as is over TLS, which already encrypts it
+func (c *binlogConn) sendEncryptedPassword(password string, scramble []byte) error {
+	if c.secure {
+		return c.writePacket(append([]byte(password), 0))
+	}
+
+	if err := c.writePacket([]byte{_cachingSha2PublicKey}); err != nil {
+		return err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	if len(packet) == 0 || packet[0] != _packetAuthMoreData {
+		return errors.New("failed to read the server public key")
+	}
+
+	block, _ := pem.Decode(packet[1:])
+	if block == nil {
+		return errors.New("failed to decode the server public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("the server public key is not a RSA key")
+	}
+
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, plain, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.writePacket(encrypted)
+}
+
+// Runs a statement that does not return rows
+func (c *binlogConn) exec(query string) error {
+	c.sequence = 0
+	if err := c.writePacket(append([]byte{_comQuery}, query...)); err != nil {
+		return err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(packet) > 0 && packet[0] == _packetOK:
+		return nil
+	case len(packet) > 0 && packet[0] == _packetErr:
+		return parseErrPacket(packet)
+	}
+
+	return fmt.Errorf("unexpected result for [%s]", query)
+}
+
+func (c *binlogConn) startBinlogDump(serverID uint32, file string, position uint32) error {
+	request := []byte{_comBinlogDump}
+	request = appendUint32(request, position)
+	request = appendUint16(request, 0)
+	request = appendUint32(request, serverID)
+	request = append(request, file...)
+
+	c.sequence = 0
+	return c.writePacket(request)
+}
+
+// Streams the transactions that are not on the encoded GTID set, the server
+// finds the binlog file to start from
+func (c *binlogConn) startBinlogDumpGTID(serverID uint32, gtids []byte) error {
+	request := []byte{_comBinlogDumpGTID}
+	request = appendUint16(request, _binlogThroughGTID)
+	request = appendUint32(request, serverID)
+	request = appendUint32(request, 0) // Binlog file name length
+	request = appendUint64(request, 4) // Binlog position
+	request = appendUint32(request, uint32(len(gtids)))
+	request = append(request, gtids...)
+
+	c.sequence = 0
+	return c.writePacket(request)
+}
+
+// Returns the next binlog event, without the OK byte that precedes it
+func (c *binlogConn) readEvent() ([]byte, error) {
+	packet, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(packet) == 0 {
+		return nil, errors.New("received an empty binlog packet")
+	}
+
+	switch packet[0] {
+	case _packetOK:
+		return packet[1:], nil
+	case _packetErr:
+		return nil, parseErrPacket(packet)
+	case _packetEOF:
+		return nil, errors.New("the server ended the binlog stream")
+	}
+
+	return nil, fmt.Errorf("unexpected binlog packet 0x%02x", packet[0])
+}
+
+func parseErrPacket(packet []byte) error {
+	r := packetReader{data: packet[1:]}
+	code := r.uint16()
+
+	// Protocol 4.1 servers send a SQL state marker and the state itself
+	if r.remaining() > 0 && r.data[r.offset] == '#' {
+		r.take(6)
+	}
+
+	return fmt.Errorf("MySQL error %d: %s", code, string(r.rest()))
+}
+
+func scramblePassword(plugin string, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+
+	if len(scramble) < 20 {
+		return nil, errors.New("received a short authentication scramble")
+	}
+
+	switch plugin {
+	case _nativePasswordPlugin:
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		stage1 := sha1.Sum([]byte(password))
+		stage2 := sha1.Sum(stage1[:])
+
+		hash := sha1.New()
+		hash.Write(scramble[:20])
+		hash.Write(stage2[:])
+
+		return xorBytes(stage1[:], hash.Sum(nil)), nil
+
+	case _cachingSha2PasswordPlugin:
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		stage1 := sha256.Sum256([]byte(password))
+		stage2 := sha256.Sum256(stage1[:])
+
+		hash := sha256.New()
+		hash.Write(stage2[:])
+		hash.Write(scramble[:20])
+
+		return xorBytes(stage1[:], hash.Sum(nil)), nil
+	}
+
+	return nil, fmt.Errorf(
+		"unsupported authentication plugin [%s], expected one of: [%s, %s]",
+		plugin,
+		_nativePasswordPlugin,
+		_cachingSha2PasswordPlugin)
+}
+
+func xorBytes(a []byte, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+
+	return result
+}
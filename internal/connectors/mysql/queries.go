@@ -0,0 +1,222 @@
+package mysql
+
+const (
+	getCurrentDatabaseQuery = `
+	SELECT DATABASE()
+	`
+
+	// MySQL reserves most of the column names, and raw strings can not hold
+	// the backticks that quote them
+	setupFromToEventTableQuery = "CREATE TABLE IF NOT EXISTS {{event}} (" +
+		"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+		"`op` CHAR(1) NOT NULL, " +
+		"`schema` VARCHAR(64) NOT NULL, " +
+		"`table` VARCHAR(64) NOT NULL, " +
+		"`row` JSON NOT NULL, " +
+		"`before` JSON NULL, " +
+		"`ts` BIGINT NOT NULL, " +
+		"`statement_ts` TIMESTAMP(6) NULL, " +
+		"`sent` BOOLEAN NOT NULL DEFAULT FALSE, " +
+		"PRIMARY KEY (`id`), " +
+		"INDEX `sent_id_idx` (`sent`, `id`)" +
+		")"
+
+	setupFromToEventDeliveryTableQuery = "CREATE TABLE IF NOT EXISTS {{delivery}} (" +
+		"`event_id` BIGINT UNSIGNED NOT NULL, " +
+		"`channel` VARCHAR(255) NOT NULL, " +
+		"`status` VARCHAR(32) NOT NULL, " +
+		"`attempts` BIGINT NOT NULL DEFAULT 0, " +
+		"`last_error` TEXT, " +
+		"`updated_at` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+		"PRIMARY KEY (`event_id`, `channel`)" +
+		")"
+
+	setupFromToDeadLetterTableQuery = "CREATE TABLE IF NOT EXISTS {{dead_letter}} (" +
+		"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+		"`event_id` BIGINT UNSIGNED NOT NULL, " +
+		"`channel` VARCHAR(255) NOT NULL, " +
+		"`event` JSON NOT NULL, " +
+		"`payload` LONGTEXT, " +
+		"`error` TEXT NOT NULL, " +
+		"`attempts` BIGINT NOT NULL, " +
+		"`created_at` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+		"PRIMARY KEY (`id`)" +
+		")"
+
+	getTableColumnsQuery = `
+	SELECT
+		c.COLUMN_NAME
+	FROM
+		information_schema.COLUMNS c
+	WHERE
+		c.TABLE_SCHEMA = ?
+		AND c.TABLE_NAME = ?
+	ORDER BY
+		c.ORDINAL_POSITION
+	`
+
+	getPrimaryKeyColumnsQuery = `
+	SELECT
+		k.COLUMN_NAME
+	FROM
+		information_schema.KEY_COLUMN_USAGE k
+	WHERE
+		k.TABLE_SCHEMA = ?
+		AND k.TABLE_NAME = ?
+		AND k.CONSTRAINT_NAME = 'PRIMARY'
+	ORDER BY
+		k.ORDINAL_POSITION
+	`
+
+	getTriggerStatementQuery = `
+	SELECT
+		t.ACTION_STATEMENT
+	FROM
+		information_schema.TRIGGERS t
+	WHERE
+		t.TRIGGER_SCHEMA = ?
+		AND t.TRIGGER_NAME = ?
+	`
+
+	// Formatted with the trigger name, operation, table and the statement.
+	// Written in a single line so the statement is stored exactly as built
+	setupTableTriggerPartialQuery = "CREATE TRIGGER %s AFTER %s ON %s FOR EACH ROW %s"
+
+	// Formatted with the operation, database, table, row and before literals
+	insertEventPartialStatement = "INSERT INTO {{event}} (`op`, `schema`, `table`, `row`, `before`, `ts`, `statement_ts`) " +
+		"VALUES (%s, %s, %s, %s, %s, UNIX_TIMESTAMP(), NOW(6))"
+
+	dropTriggerPartialQuery = `
+	DROP TRIGGER IF EXISTS %s
+	`
+
+	getEventsToSendQuery = `
+	SELECT
+		fte.id,
+		fte.op,
+		fte.schema,
+		fte.table,
+		fte.row,
+		fte.before,
+		fte.ts,
+		fte.statement_ts,
+		fte.sent
+	FROM
+		{{event}} fte
+	WHERE
+		fte.sent = FALSE
+	ORDER BY
+		fte.id ASC
+	LIMIT
+		?
+	`
+
+	// Formatted with a placeholder for each id
+	setEventsAsSentPartialQuery = `
+	UPDATE
+		{{event}}
+	SET
+		sent = TRUE
+	WHERE
+		id IN (%s)
+	`
+
+	// Formatted with a placeholder for each id
+	getDeliveredChannelsPartialQuery = `
+	SELECT
+		fted.event_id,
+		fted.channel
+	FROM
+		{{delivery}} fted
+	WHERE
+		fted.event_id IN (%s)
+		AND fted.status = 'delivered'
+	`
+
+	saveDeliveryQuery = `
+	INSERT INTO {{delivery}} (
+		event_id,
+		channel,
+		status,
+		attempts,
+		last_error,
+		updated_at
+	) VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		NOW(6)
+	)
+	ON DUPLICATE KEY UPDATE
+		status = VALUES(status),
+		attempts = attempts + VALUES(attempts),
+		last_error = VALUES(last_error),
+		updated_at = VALUES(updated_at)
+	`
+
+	insertDeadLetterQuery = "INSERT INTO {{dead_letter}} (" +
+		"`event_id`, `channel`, `event`, `payload`, `error`, `attempts`" +
+		") VALUES (?, ?, ?, ?, ?, ?)"
+
+	getBinlogSettingsQuery = `
+	SELECT
+		@@global.binlog_format,
+		@@global.binlog_row_image,
+		@@global.binlog_checksum
+	`
+
+	// Renamed on MySQL 8.2, older servers only have the previous name
+	getBinaryLogStatusQuery = `SHOW BINARY LOG STATUS`
+
+	getMasterStatusQuery = `SHOW MASTER STATUS`
+
+	getGTIDModeQuery = `SELECT @@global.gtid_mode`
+
+	// Only available on MySQL 8.0.1 and MariaDB 10.5 or later
+	getBinlogRowMetadataQuery = `SELECT @@global.binlog_row_metadata`
+
+	getServerVersionQuery = `SELECT VERSION()`
+
+	getBinlogColumnsQuery = `
+	SELECT
+		c.COLUMN_NAME,
+		c.DATA_TYPE,
+		c.COLUMN_TYPE
+	FROM
+		information_schema.COLUMNS c
+	WHERE
+		c.TABLE_SCHEMA = ?
+		AND c.TABLE_NAME = ?
+	ORDER BY
+		c.ORDINAL_POSITION
+	`
+
+	setupBinlogCheckpointTableQuery = "CREATE TABLE IF NOT EXISTS {{binlog_checkpoint}} (" +
+		"`id` TINYINT NOT NULL, " +
+		"`file` VARCHAR(255) NOT NULL, " +
+		"`position` BIGINT UNSIGNED NOT NULL, " +
+		"`sequence` BIGINT UNSIGNED NOT NULL DEFAULT 0, " +
+		"`gtid_set` TEXT NOT NULL, " +
+		"`updated_at` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+		"PRIMARY KEY (`id`)" +
+		")"
+
+	getBinlogCheckpointQuery = "SELECT `file`, `position`, `sequence`, `gtid_set` FROM {{binlog_checkpoint}} WHERE `id` = 1"
+
+	saveBinlogCheckpointQuery = "INSERT INTO {{binlog_checkpoint}} (`id`, `file`, `position`, `sequence`, `gtid_set`, `updated_at`) " +
+		"VALUES (1, ?, ?, ?, ?, NOW(6)) " +
+		"ON DUPLICATE KEY UPDATE `file` = VALUES(`file`), `position` = VALUES(`position`), " +
+		"`sequence` = VALUES(`sequence`), `gtid_set` = VALUES(`gtid_set`), `updated_at` = VALUES(`updated_at`)"
+
+	// Tell the server the replica understands checksums and heartbeats, both
+	// names are set as MySQL 8.4 only reads the new ones
+	setMasterBinlogChecksumQuery = `SET @master_binlog_checksum = @@global.binlog_checksum`
+
+	setSourceBinlogChecksumQuery = `SET @source_binlog_checksum = @@global.binlog_checksum`
+
+	setMasterHeartbeatPeriodPartialQuery = `SET @master_heartbeat_period = %d`
+
+	setSourceHeartbeatPeriodPartialQuery = `SET @source_heartbeat_period = %d`
+)
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var _triggerEvents = map[string]string{
+	OperationInsert: "INSERT",
+	OperationUpdate: "UPDATE",
+	OperationDelete: "DELETE",
+}
+
+// Triggers can not be replaced in place on MySQL, so a trigger is only
+// dropped and created again when its statement changed, such as after a
+// column was added to the table. Changes made between the drop and the create
+// are not captured
+func (l *Listener) setupTableTrigger(ctx context.Context, table Table) error {
+	columns, err := l.getTableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	if len(columns) == 0 {
+		return fmt.Errorf("table [%s] does not exist", table.Name)
+	}
+
+	operations := table.OperationsOrDefault()
+	for _, operation := range []string{OperationInsert, OperationUpdate, OperationDelete} {
+		name := l.names.triggerName(operation, table.relation)
+		quotedName := quoteIdentifier(table.schema) + "." + quoteIdentifier(name)
+
+		if !slices.Contains(operations, operation) {
+			if _, err := l.db.ExecContext(ctx, fmt.Sprintf(dropTriggerPartialQuery, quotedName)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		statement := l.triggerStatement(table, operation, columns)
+
+		installed, err := l.getTriggerStatement(ctx, table.schema, name)
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(installed) == statement {
+			continue
+		}
+
+		queries := []string{
+			fmt.Sprintf(dropTriggerPartialQuery, quotedName),
+			fmt.Sprintf(
+				setupTableTriggerPartialQuery,
+				quotedName,
+				_triggerEvents[operation],
+				quoteIdentifier(table.schema)+"."+quoteIdentifier(table.relation),
+				statement),
+		}
+
+		for _, query := range queries {
+			if _, err := l.db.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to setup trigger [%s], got error %s", name, err.Error())
+			}
+		}
+
+		l.logger.Debug("Trigger installed", "trigger", name, "table", table.Name)
+	}
+
+	return nil
+}
+
+// Builds the statement that inserts the event, the rows are built with
+// JSON_OBJECT over the columns the table had when the trigger was created
+func (l *Listener) triggerStatement(table Table, operation string, columns []string) string {
+	row := jsonObject("NEW", columns)
+	before := "NULL"
+
+	switch operation {
+	case OperationUpdate:
+		before = jsonObject("OLD", columns)
+	case OperationDelete:
+		row = jsonObject("OLD", columns)
+	}
+
+	return fmt.Sprintf(
+		l.names.render(insertEventPartialStatement),
+		quoteLiteral(operation),
+		quoteLiteral(table.schema),
+		quoteLiteral(table.relation),
+		row,
+		before)
+}
+
+func jsonObject(reference string, columns []string) string {
+	arguments := make([]string, 0, len(columns))
+	for _, column := range columns {
+		arguments = append(arguments, quoteLiteral(column)+", "+reference+"."+quoteIdentifier(column))
+	}
+
+	return "JSON_OBJECT(" + strings.Join(arguments, ", ") + ")"
+}
+
+func (l *Listener) getTableColumns(ctx context.Context, table Table) ([]string, error) {
+	return queryColumns(ctx, l.db, getTableColumnsQuery, table)
+}
+
+func getPrimaryKeyColumns(ctx context.Context, db *sql.DB, table Table) ([]string, error) {
+	return queryColumns(ctx, db, getPrimaryKeyColumnsQuery, table)
+}
+
+func queryColumns(ctx context.Context, db *sql.DB, query string, table Table) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, table.schema, table.relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// Returns an empty statement if the trigger is not installed
+func (l *Listener) getTriggerStatement(ctx context.Context, schema string, name string) (string, error) {
+	var statement string
+	err := l.db.QueryRowContext(ctx, getTriggerStatementQuery, schema, name).Scan(&statement)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return statement, err
+}
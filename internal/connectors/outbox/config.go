@@ -0,0 +1,166 @@
+package outbox
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+
+	// Sets the processed column of published messages to true
+	MarkFlag = "flag"
+
+	// Deletes published messages from the outbox table
+	MarkDelete = "delete"
+
+	// Saves the id of the last published message on a checkpoint table, the
+	// outbox table is never written to. Relies on ids being committed in
+	// order, see Config.GapTimeoutSeconds
+	MarkCheckpoint = "checkpoint"
+)
+
+// Names of the outbox table columns. Only id, table and payload are required,
+// the optional columns are not read when empty
+type ColumnsConfig struct {
+	ID        string `yaml:"id"`
+	Table     string `yaml:"table"`
+	Op        string `yaml:"op"`
+	Payload   string `yaml:"payload"`
+	CreatedAt string `yaml:"createdAt"`
+	Key       string `yaml:"key"`
+	Processed string `yaml:"processed"`
+}
+
+func (cc *ColumnsConfig) IDOrDefault() string {
+	if cc.ID == "" {
+		return "id"
+	}
+
+	return cc.ID
+}
+
+func (cc *ColumnsConfig) TableOrDefault() string {
+	if cc.Table == "" {
+		return "aggregate"
+	}
+
+	return cc.Table
+}
+
+func (cc *ColumnsConfig) PayloadOrDefault() string {
+	if cc.Payload == "" {
+		return "payload"
+	}
+
+	return cc.Payload
+}
+
+func (cc *ColumnsConfig) ProcessedOrDefault() string {
+	if cc.Processed == "" {
+		return "processed"
+	}
+
+	return cc.Processed
+}
+
+type Config struct {
+	Dialect         string        `yaml:"dialect"`
+	DSN             string        `yaml:"dsn"`
+	TimeoutSeconds  uint64        `yaml:"timeoutSeconds"`
+	PollSeconds     uint64        `yaml:"pollSeconds"`
+	PollLimit       uint64        `yaml:"pollLimit"`
+	Table           string        `yaml:"table"`
+	Columns         ColumnsConfig `yaml:"columns"`
+	MarkStrategy    string        `yaml:"markStrategy"`
+	CheckpointTable string        `yaml:"checkpointTable"`
+
+	// How long the checkpoint strategy waits for a missing id to be committed
+	// before skipping it
+	GapTimeoutSeconds uint64 `yaml:"gapTimeoutSeconds"`
+}
+
+func (c *Config) Validate() error {
+	switch c.Dialect {
+	case DialectPostgres, DialectMySQL:
+	default:
+		return fmt.Errorf("invalid outbox dialect [%s], expected one of: [%s, %s]", c.Dialect, DialectPostgres, DialectMySQL)
+	}
+
+	switch c.MarkStrategyOrDefault() {
+	case MarkFlag, MarkDelete, MarkCheckpoint:
+	default:
+		return fmt.Errorf(
+			"invalid outbox mark strategy [%s], expected one of: [%s, %s, %s]",
+			c.MarkStrategy,
+			MarkFlag,
+			MarkDelete,
+			MarkCheckpoint)
+	}
+
+	parts := strings.Split(c.TableOrDefault(), ".")
+	if len(parts) > 2 || slices.Contains(parts, "") {
+		return fmt.Errorf("invalid outbox table name [%s], expected [table] or [schema.table]", c.Table)
+	}
+
+	return nil
+}
+
+func (c *Config) TimeoutSecondsOrDefault() time.Duration {
+	if c.TimeoutSeconds == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+func (c *Config) PollSecondsOrDefault() time.Duration {
+	if c.PollSeconds == 0 {
+		return 5 * time.Second
+	}
+
+	return time.Duration(c.PollSeconds) * time.Second
+}
+
+func (c *Config) LimitOrDefault() uint64 {
+	if c.PollLimit == 0 {
+		return 50
+	}
+
+	return c.PollLimit
+}
+
+func (c *Config) TableOrDefault() string {
+	if c.Table == "" {
+		return "outbox"
+	}
+
+	return c.Table
+}
+
+func (c *Config) MarkStrategyOrDefault() string {
+	if c.MarkStrategy == "" {
+		return MarkFlag
+	}
+
+	return c.MarkStrategy
+}
+
+func (c *Config) CheckpointTableOrDefault() string {
+	if c.CheckpointTable == "" {
+		return "from_to_outbox_checkpoint"
+	}
+
+	return c.CheckpointTable
+}
+
+func (c *Config) GapTimeoutSecondsOrDefault() time.Duration {
+	if c.GapTimeoutSeconds == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(c.GapTimeoutSeconds) * time.Second
+}
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// What differs between the supported databases, every other query is shared
+type dialect struct {
+	name                             string
+	open                             func(dsn string) (*sql.DB, error)
+	quoteIdentifier                  func(name string) string
+	placeholder                      func(position int) string
+	setupCheckpointTablePartialQuery string
+	saveCheckpointPartialQuery       string
+}
+
+var _dialects = map[string]dialect{
+	DialectPostgres: {
+		name: DialectPostgres,
+		open: func(dsn string) (*sql.DB, error) {
+			return sql.Open("postgres", dsn)
+		},
+		quoteIdentifier: pq.QuoteIdentifier,
+		placeholder: func(position int) string {
+			return fmt.Sprintf("$%d", position)
+		},
+		setupCheckpointTablePartialQuery: setupPostgresCheckpointTablePartialQuery,
+		saveCheckpointPartialQuery:       savePostgresCheckpointPartialQuery,
+	},
+	DialectMySQL: {
+		name: DialectMySQL,
+		open: openMySQL,
+		quoteIdentifier: func(name string) string {
+			return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+		},
+		placeholder: func(int) string {
+			return "?"
+		},
+		setupCheckpointTablePartialQuery: setupMySQLCheckpointTablePartialQuery,
+		saveCheckpointPartialQuery:       saveMySQLCheckpointPartialQuery,
+	},
+}
+
+// Timestamps are always parsed, so the created at column can be read
+// regardless of the DSN options
+func openMySQL(dsn string) (*sql.DB, error) {
+	config, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ParseTime = true
+
+	connector, err := gomysql.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+// Quotes every part of a schema qualified name
+func (d *dialect) quoteName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = d.quoteIdentifier(part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// Returns the placeholders of an IN list with n values
+func (d *dialect) placeholders(n int) string {
+	placeholders := make([]string, 0, n)
+	for i := range n {
+		placeholders = append(placeholders, d.placeholder(i+1))
+	}
+
+	return strings.Join(placeholders, ", ")
+}
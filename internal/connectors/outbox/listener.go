@@ -0,0 +1,413 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+// Relays the messages that services write to their own outbox table, without
+// installing triggers. Messages are published in id order, and are only
+// marked as processed after every channel routed to them has acknowledged
+type Listener struct {
+	limit                  uint64
+	waitSeconds            time.Duration
+	timeout                time.Duration
+	db                     *sql.DB
+	logger                 *slog.Logger
+	tableToChannelRelation map[string][]event.Channel
+	retrier                event.Retrier
+	dialect                dialect
+	markStrategy           string
+	table                  string
+	columns                ColumnsConfig
+	checkpointTable        string
+	lastID                 uint64
+	gapTimeout             time.Duration
+	gapID                  uint64
+	gapSince               time.Time
+}
+
+func NewListener(config Config, channels map[string]event.Channel) (*Listener, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	listener := &Listener{
+		limit:        config.LimitOrDefault(),
+		waitSeconds:  config.PollSecondsOrDefault(),
+		timeout:      config.TimeoutSecondsOrDefault(),
+		logger:       slog.With("listener", "Outbox"),
+		dialect:      _dialects[config.Dialect],
+		markStrategy: config.MarkStrategyOrDefault(),
+		table:        config.TableOrDefault(),
+		columns:      config.Columns,
+		gapTimeout:   config.GapTimeoutSecondsOrDefault(),
+	}
+
+	listener.checkpointTable = listener.dialect.quoteName(config.CheckpointTableOrDefault())
+	listener.retrier = event.Retrier{
+		Interval: listener.waitSeconds,
+		Logger:   listener.logger,
+	}
+
+	// The outbox table belongs to the service, so there is no table of ours to
+	// write dead letters to
+	if event.UsesDeadLetterTable(channels) {
+		return nil, errors.New("dead letter tables are not supported by the outbox input, use deadLetter.to instead")
+	}
+
+	if event.UsesTransactionMarkers(channels) {
+		listener.logger.Warn("Transaction markers are not supported by the outbox input, ignoring")
+	}
+
+	if err := listener.connectToDatabase(config.DSN); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
+	listener.logger.Info("Connector setup completed", "table", listener.table, "markStrategy", listener.markStrategy)
+
+	return listener, nil
+}
+
+// Listens for messages until ctx is done. A batch that already started is
+// completed unless a channel keeps failing, so its messages are not left
+// half published
+func (l *Listener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	for {
+		if err := l.processMessages(ctx, callback); err != nil {
+			if ctx.Err() != nil {
+				l.logger.Info("Listener stopped")
+				return nil
+			}
+
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			l.logger.Info("Listener stopped")
+			return nil
+
+		case <-time.After(l.waitSeconds):
+			l.logger.Debug("Polling for new outbox messages")
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return l.db.Close()
+}
+
+func (l *Listener) connectToDatabase(dsn string) error {
+	db, err := l.dialect.open(dsn)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	l.db = db
+
+	l.logger.Debug("Connected to database", "dialect", l.dialect.name)
+	return nil
+}
+
+// Only the checkpoint strategy creates a table, the other ones only need the
+// outbox table
+func (l *Listener) setupCheckpoint() error {
+	if l.markStrategy != MarkCheckpoint {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(l.dialect.setupCheckpointTablePartialQuery, l.checkpointTable)
+	if _, err := l.db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(getCheckpointPartialQuery, l.checkpointTable, l.dialect.placeholder(1))
+	err := l.db.QueryRowContext(ctx, query, l.table).Scan(&l.lastID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	l.logger.Debug("Checkpoint setup complete", "table", l.checkpointTable, "lastId", l.lastID)
+
+	return nil
+}
+
+func (l *Listener) processMessages(
+	ctx context.Context,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	for ctx.Err() == nil {
+		batchCtx := context.WithoutCancel(ctx)
+
+		events, err := l.getMessages(batchCtx)
+		if err != nil {
+			return err
+		}
+
+		if l.markStrategy == MarkCheckpoint {
+			events = l.messagesBeforeGap(events)
+		}
+
+		if len(events) > 0 {
+			l.logger.Info(fmt.Sprintf("Processing %d messages", len(events)))
+		}
+
+		processedIDs := make([]any, 0, len(events))
+		for _, e := range events {
+			if err = l.publishEvent(ctx, e, callback); err != nil {
+				break
+			}
+
+			processedIDs = append(processedIDs, e.ID)
+		}
+
+		// Messages published before a failure are still marked, so they are
+		// not published again on the next poll
+		if markErr := l.markAsProcessed(batchCtx, processedIDs); markErr != nil {
+			return errors.Join(err, markErr)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// A full batch means there may be more messages waiting, so keep
+		// draining the backlog before going back to sleep
+		if uint64(len(events)) < l.limit {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Messages are returned by id, the checkpoint strategy relies on ids being
+// committed in increasing order
+func (l *Listener) getMessages(ctx context.Context) ([]event.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	columns := []string{
+		l.dialect.quoteIdentifier(l.columns.IDOrDefault()),
+		l.dialect.quoteIdentifier(l.columns.TableOrDefault()),
+		l.dialect.quoteIdentifier(l.columns.PayloadOrDefault()),
+	}
+
+	for _, column := range []string{l.columns.Op, l.columns.CreatedAt, l.columns.Key} {
+		if column != "" {
+			columns = append(columns, l.dialect.quoteIdentifier(column))
+		}
+	}
+
+	var condition string
+	var args []any
+	switch l.markStrategy {
+	case MarkFlag:
+		condition = fmt.Sprintf(unprocessedPartialCondition, l.dialect.quoteIdentifier(l.columns.ProcessedOrDefault()))
+	case MarkCheckpoint:
+		condition = fmt.Sprintf(afterCheckpointPartialCondition, l.dialect.quoteIdentifier(l.columns.IDOrDefault()), l.dialect.placeholder(1))
+		args = append(args, l.lastID)
+	}
+
+	query := fmt.Sprintf(
+		getMessagesPartialQuery,
+		strings.Join(columns, ", "),
+		l.dialect.quoteName(l.table),
+		condition,
+		l.dialect.quoteIdentifier(l.columns.IDOrDefault()),
+		l.limit)
+
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []event.Event
+	for rows.Next() {
+		e, err := l.scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// Ids are taken when messages are inserted but only become visible when their
+// transaction commits, so a missing id may still be committed after higher ids
+// were read. The checkpoint would move past it, so the messages after the
+// first gap are held back until it is filled, or until it is older than the
+// gap timeout, since the ids of rolled back transactions are never filled
+func (l *Listener) messagesBeforeGap(events []event.Event) []event.Event {
+	next := l.lastID + 1
+	for i, e := range events {
+		if e.ID == next {
+			next++
+			continue
+		}
+
+		if l.gapID != next {
+			l.gapID = next
+			l.gapSince = time.Now()
+		}
+
+		if time.Since(l.gapSince) < l.gapTimeout {
+			l.logger.Debug("Waiting for missing outbox ids to be committed", "from", next, "to", e.ID-1)
+			return events[:i]
+		}
+
+		l.logger.Warn("Skipping missing outbox ids, their transactions were likely rolled back", "from", next, "to", e.ID-1)
+		next = e.ID + 1
+	}
+
+	return events
+}
+
+func (l *Listener) scanMessage(rows *sql.Rows) (event.Event, error) {
+	e := event.Event{
+		Op: event.OpInsert,
+	}
+
+	var table, op sql.NullString
+	var payload []byte
+	var createdAt sql.NullTime
+	var key any
+
+	dest := []any{&e.ID, &table, &payload}
+	if l.columns.Op != "" {
+		dest = append(dest, &op)
+	}
+
+	if l.columns.CreatedAt != "" {
+		dest = append(dest, &createdAt)
+	}
+
+	if l.columns.Key != "" {
+		dest = append(dest, &key)
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return e, err
+	}
+
+	e.Table = table.String
+
+	if op.Valid {
+		e.Op = op.String
+	}
+
+	if createdAt.Valid {
+		e.Timestamp = createdAt.Time
+		e.Ts = uint64(createdAt.Time.Unix())
+	}
+
+	if key != nil {
+		if b, ok := key.([]byte); ok {
+			key = string(b)
+		}
+
+		e.Key = map[string]any{l.columns.Key: key}
+	}
+
+	e.Row = payloadToRow(payload)
+
+	return e, nil
+}
+
+// JSON objects are used as the row, any other payload, including the ones
+// that are not JSON, is kept under the "payload" field
+func payloadToRow(payload []byte) map[string]any {
+	if payload == nil {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return map[string]any{"payload": string(payload)}
+	}
+
+	if row, ok := value.(map[string]any); ok {
+		return row
+	}
+
+	return map[string]any{"payload": value}
+}
+
+func (l *Listener) markAsProcessed(ctx context.Context, ids []any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var query string
+	args := ids
+	switch l.markStrategy {
+	case MarkFlag:
+		query = fmt.Sprintf(
+			setMessagesAsProcessedPartialQuery,
+			l.dialect.quoteName(l.table),
+			l.dialect.quoteIdentifier(l.columns.ProcessedOrDefault()),
+			l.dialect.quoteIdentifier(l.columns.IDOrDefault()),
+			l.dialect.placeholders(len(ids)))
+
+	case MarkDelete:
+		query = fmt.Sprintf(
+			deleteMessagesPartialQuery,
+			l.dialect.quoteName(l.table),
+			l.dialect.quoteIdentifier(l.columns.IDOrDefault()),
+			l.dialect.placeholders(len(ids)))
+
+	case MarkCheckpoint:
+		query = fmt.Sprintf(l.dialect.saveCheckpointPartialQuery, l.checkpointTable)
+		args = []any{l.table, ids[len(ids)-1]}
+	}
+
+	if _, err := l.db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	if l.markStrategy == MarkCheckpoint {
+		l.lastID = ids[len(ids)-1].(uint64)
+	}
+
+	l.logger.Debug("Marked messages as processed", "messages", len(ids), "strategy", l.markStrategy)
+
+	return nil
+}
+
+// The message is not marked while it is retried, so it is published again if
+// the application stops before every channel acknowledged it
+func (l *Listener) publishEvent(
+	ctx context.Context,
+	e event.Event,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	return l.retrier.Publish(ctx, e, l.tableToChannelRelation, callback)
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+func messageIDs(events []event.Event) []uint64 {
+	ids := make([]uint64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func messagesWithIDs(ids ...uint64) []event.Event {
+	events := make([]event.Event, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, event.Event{ID: id})
+	}
+
+	return events
+}
+
+func TestMessagesBeforeGap(t *testing.T) {
+	l := &Listener{
+		logger:     slog.Default(),
+		lastID:     10,
+		gapTimeout: time.Minute,
+	}
+
+	if ids := messageIDs(l.messagesBeforeGap(messagesWithIDs(11, 12, 13))); len(ids) != 3 {
+		t.Errorf("messages without gaps should all be returned, got %v", ids)
+	}
+
+	ids := messageIDs(l.messagesBeforeGap(messagesWithIDs(11, 12, 14, 15)))
+	if len(ids) != 2 || ids[1] != 12 {
+		t.Errorf("messages after the gap should be held back, got %v", ids)
+	}
+
+	if ids := messageIDs(l.messagesBeforeGap(messagesWithIDs(12))); len(ids) != 0 {
+		t.Errorf("a gap right after the checkpoint should hold back every message, got %v", ids)
+	}
+
+	// Once the gap is older than the timeout it is skipped
+	l.gapSince = time.Now().Add(-2 * time.Minute)
+	ids = messageIDs(l.messagesBeforeGap(messagesWithIDs(12, 13)))
+	if len(ids) != 2 {
+		t.Errorf("an expired gap should be skipped, got %v", ids)
+	}
+
+	// A new gap starts its own timeout
+	l.lastID = 13
+	if ids := messageIDs(l.messagesBeforeGap(messagesWithIDs(15))); len(ids) != 0 {
+		t.Errorf("a new gap should be waited for, got %v", ids)
+	}
+}
@@ -0,0 +1,104 @@
+package outbox
+
+const (
+	// Formatted with the columns, the outbox table, the condition, the id
+	// column and the limit
+	getMessagesPartialQuery = `
+	SELECT
+		%s
+	FROM
+		%s
+	%s
+	ORDER BY
+		%s ASC
+	LIMIT
+		%d
+	`
+
+	// Formatted with the processed column
+	unprocessedPartialCondition = `WHERE COALESCE(%s, FALSE) = FALSE`
+
+	// Formatted with the id column and the last id placeholder
+	afterCheckpointPartialCondition = `WHERE %s > %s`
+
+	// Formatted with the outbox table, the processed column, the id column and
+	// a placeholder for each id
+	setMessagesAsProcessedPartialQuery = `
+	UPDATE
+		%s
+	SET
+		%s = TRUE
+	WHERE
+		%s IN (%s)
+	`
+
+	// Formatted with the outbox table, the id column and a placeholder for each
+	// id
+	deleteMessagesPartialQuery = `
+	DELETE FROM
+		%s
+	WHERE
+		%s IN (%s)
+	`
+
+	// Formatted with the checkpoint table and the outbox table placeholder
+	getCheckpointPartialQuery = `
+	SELECT
+		last_id
+	FROM
+		%s
+	WHERE
+		outbox_table = %s
+	`
+
+	// Formatted with the checkpoint table
+	setupPostgresCheckpointTablePartialQuery = `
+	CREATE TABLE IF NOT EXISTS %s (
+		outbox_table TEXT PRIMARY KEY,
+		last_id BIGINT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)
+	`
+
+	// Formatted with the checkpoint table
+	savePostgresCheckpointPartialQuery = `
+	INSERT INTO %s (
+		outbox_table,
+		last_id,
+		updated_at
+	) VALUES (
+		$1,
+		$2,
+		NOW()
+	)
+	ON CONFLICT (outbox_table) DO UPDATE SET
+		last_id = EXCLUDED.last_id,
+		updated_at = EXCLUDED.updated_at
+	`
+
+	// Formatted with the checkpoint table
+	setupMySQLCheckpointTablePartialQuery = `
+	CREATE TABLE IF NOT EXISTS %s (
+		outbox_table VARCHAR(255) NOT NULL,
+		last_id BIGINT UNSIGNED NOT NULL,
+		updated_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+		PRIMARY KEY (outbox_table)
+	)
+	`
+
+	// Formatted with the checkpoint table
+	saveMySQLCheckpointPartialQuery = `
+	INSERT INTO %s (
+		outbox_table,
+		last_id,
+		updated_at
+	) VALUES (
+		?,
+		?,
+		NOW(6)
+	)
+	ON DUPLICATE KEY UPDATE
+		last_id = VALUES(last_id),
+		updated_at = VALUES(updated_at)
+	`
+)
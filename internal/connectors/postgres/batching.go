@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"time"
+)
+
+// Chooses how many events are fetched per batch. Without adaptive batching
+// the limit is always the configured poll limit
+type batchSizer struct {
+	limit         uint64
+	minLimit      uint64
+	maxLimit      uint64
+	targetLatency time.Duration
+	adaptive      bool
+}
+
+func newBatchSizer(config Config) batchSizer {
+	sizer := batchSizer{
+		limit:         config.LimitOrDefault(),
+		minLimit:      config.Batching.MinLimitOrDefault(),
+		maxLimit:      config.Batching.MaxLimitOrDefault(),
+		targetLatency: config.Batching.TargetLatencyOrDefault(),
+		adaptive:      config.Batching.Adaptive,
+	}
+
+	if sizer.adaptive {
+		sizer.limit = min(max(sizer.limit, sizer.minLimit), sizer.maxLimit)
+	}
+
+	return sizer
+}
+
+// Doubles the limit while full batches take less than half the target
+// latency, and halves it while batches take longer than the target
+func (b *batchSizer) adjust(events uint64, elapsed time.Duration) {
+	if !b.adaptive {
+		return
+	}
+
+	switch {
+	case elapsed > b.targetLatency:
+		b.limit = max(b.limit/2, b.minLimit)
+
+	case events >= b.limit && elapsed < b.targetLatency/2:
+		b.limit = min(b.limit*2, b.maxLimit)
+	}
+}
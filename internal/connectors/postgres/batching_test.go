@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchSizerFixed(t *testing.T) {
+	sizer := newBatchSizer(Config{PollLimit: 20})
+
+	sizer.adjust(20, time.Millisecond)
+	sizer.adjust(20, time.Hour)
+
+	if sizer.limit != 20 {
+		t.Errorf("the limit should not change without adaptive batching, got %d", sizer.limit)
+	}
+}
+
+func TestBatchSizerAdaptive(t *testing.T) {
+	config := Config{
+		PollLimit: 5,
+		Batching: BatchingConfig{
+			Adaptive:        true,
+			MinLimit:        10,
+			MaxLimit:        40,
+			TargetLatencyMs: 100,
+		},
+	}
+
+	sizer := newBatchSizer(config)
+	if sizer.limit != 10 {
+		t.Fatalf("the poll limit should be raised to the min limit, got %d", sizer.limit)
+	}
+
+	steps := []struct {
+		name     string
+		events   uint64
+		elapsed  time.Duration
+		expected uint64
+	}{
+		{"fast full batch doubles", 10, 10 * time.Millisecond, 20},
+		{"fast partial batch keeps", 5, 10 * time.Millisecond, 20},
+		{"full batch near the target keeps", 20, 80 * time.Millisecond, 20},
+		{"doubling stops at the max limit", 20, 10 * time.Millisecond, 40},
+		{"capped at the max limit", 40, 10 * time.Millisecond, 40},
+		{"slow batch halves", 40, 200 * time.Millisecond, 20},
+		{"halving stops at the min limit", 20, 200 * time.Millisecond, 10},
+		{"floored at the min limit", 10, 200 * time.Millisecond, 10},
+	}
+
+	for _, step := range steps {
+		sizer.adjust(step.events, step.elapsed)
+		if sizer.limit != step.expected {
+			t.Fatalf("%s: expected limit %d, got %d", step.name, step.expected, sizer.limit)
+		}
+	}
+}
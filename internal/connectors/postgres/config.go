@@ -1,13 +1,351 @@
 package postgres
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+	"github.com/lib/pq"
+)
+
+type ReplicationConfig struct {
+	SlotName              string `yaml:"slotName"`
+	PublicationName       string `yaml:"publicationName"`
+	StatusIntervalSeconds uint64 `yaml:"statusIntervalSeconds"`
+}
+
+func (rc *ReplicationConfig) SlotNameOrDefault(namePrefix string) string {
+	if rc.SlotName == "" {
+		return namePrefix + "slot"
+	}
+
+	return rc.SlotName
+}
+
+func (rc *ReplicationConfig) PublicationNameOrDefault(namePrefix string) string {
+	if rc.PublicationName == "" {
+		return namePrefix + "publication"
+	}
+
+	return rc.PublicationName
+}
+
+func (rc *ReplicationConfig) StatusIntervalSecondsOrDefault() time.Duration {
+	if rc.StatusIntervalSeconds == 0 {
+		return 10 * time.Second
+	}
+
+	return time.Duration(rc.StatusIntervalSeconds) * time.Second
+}
+
+const (
+	CoordinationModeNone   = "none"
+	CoordinationModeLease  = "lease"
+	CoordinationModeLeader = "leader"
+)
+
+type CoordinationConfig struct {
+	Mode         string `yaml:"mode"`
+	LeaseSeconds uint64 `yaml:"leaseSeconds"`
+	InstanceID   string `yaml:"instanceId"`
+	LockID       int64  `yaml:"lockId"`
+}
+
+func (cc *CoordinationConfig) ModeOrDefault() string {
+	if cc.Mode == "" {
+		return CoordinationModeNone
+	}
+
+	return cc.Mode
+}
+
+func (cc *CoordinationConfig) LeaseSecondsOrDefault() time.Duration {
+	if cc.LeaseSeconds == 0 {
+		return 60 * time.Second
+	}
+
+	return time.Duration(cc.LeaseSeconds) * time.Second
+}
+
+func (cc *CoordinationConfig) InstanceIDOrDefault() string {
+	if cc.InstanceID != "" {
+		return cc.InstanceID
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "from-to"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// The default lock id is derived from the event table name, so deployments
+// using different event tables do not contend for the same lock
+func (cc *CoordinationConfig) LockIDOrDefault(eventTable string) int64 {
+	if cc.LockID == 0 {
+		hash := fnv.New64a()
+		hash.Write([]byte(eventTable))
+
+		return int64(hash.Sum64())
+	}
+
+	return cc.LockID
+}
+
+type RetentionConfig struct {
+	MaxAgeHours     uint64 `yaml:"maxAgeHours"`
+	MaxRows         uint64 `yaml:"maxRows"`
+	BatchSize       uint64 `yaml:"batchSize"`
+	IntervalSeconds uint64 `yaml:"intervalSeconds"`
+	Archive         bool   `yaml:"archive"`
+	Partitioned     bool   `yaml:"partitioned"`
+}
+
+func (rc *RetentionConfig) Enabled() bool {
+	return rc.MaxAgeHours > 0 || rc.MaxRows > 0
+}
+
+func (rc *RetentionConfig) MaxAgeOrDefault() time.Duration {
+	return time.Duration(rc.MaxAgeHours) * time.Hour
+}
+
+func (rc *RetentionConfig) BatchSizeOrDefault() uint64 {
+	if rc.BatchSize == 0 {
+		return 1000
+	}
+
+	return rc.BatchSize
+}
+
+func (rc *RetentionConfig) IntervalSecondsOrDefault() time.Duration {
+	if rc.IntervalSeconds == 0 {
+		return 5 * time.Minute
+	}
+
+	return time.Duration(rc.IntervalSeconds) * time.Second
+}
+
+// Adaptive batching grows the poll limit while full batches are processed
+// faster than the target latency, and shrinks it while they are slower
+type BatchingConfig struct {
+	Adaptive        bool   `yaml:"adaptive"`
+	MinLimit        uint64 `yaml:"minLimit"`
+	MaxLimit        uint64 `yaml:"maxLimit"`
+	TargetLatencyMs uint64 `yaml:"targetLatencyMs"`
+}
+
+func (bc *BatchingConfig) MinLimitOrDefault() uint64 {
+	if bc.MinLimit == 0 {
+		return 10
+	}
+
+	return bc.MinLimit
+}
+
+func (bc *BatchingConfig) MaxLimitOrDefault() uint64 {
+	if bc.MaxLimit == 0 {
+		return 1000
+	}
+
+	return bc.MaxLimit
+}
+
+func (bc *BatchingConfig) TargetLatencyOrDefault() time.Duration {
+	if bc.TargetLatencyMs == 0 {
+		return time.Second
+	}
+
+	return time.Duration(bc.TargetLatencyMs) * time.Millisecond
+}
+
+const (
+	MaskHash     = "hash"
+	MaskRedact   = "redact"
+	MaskTruncate = "truncate"
+)
+
+// Columns captured by the trigger, applied before the row is written to the
+// event table. The exclude list is applied after the include list, and masks
+// are applied to the remaining columns
+type ColumnsConfig struct {
+	Include        []string          `yaml:"include" json:"include,omitempty"`
+	Exclude        []string          `yaml:"exclude" json:"exclude,omitempty"`
+	Mask           map[string]string `yaml:"mask" json:"mask,omitempty"`
+	TruncateLength uint64            `yaml:"truncateLength" json:"truncateLength,omitempty"`
+}
+
+func (cc *ColumnsConfig) Enabled() bool {
+	return len(cc.Include) > 0 || len(cc.Exclude) > 0 || len(cc.Mask) > 0
+}
+
+func (cc *ColumnsConfig) TruncateLengthOrDefault() uint64 {
+	if cc.TruncateLength == 0 {
+		return 4
+	}
+
+	return cc.TruncateLength
+}
+
+func (cc *ColumnsConfig) Validate() error {
+	for column, mask := range cc.Mask {
+		switch mask {
+		case MaskHash, MaskRedact, MaskTruncate:
+			continue
+		}
+
+		return fmt.Errorf(
+			"invalid mask [%s] for column [%s], expected one of: [%s, %s, %s]",
+			mask,
+			column,
+			MaskHash,
+			MaskRedact,
+			MaskTruncate)
+	}
+
+	return nil
+}
+
+const (
+	OperationInsert   = event.OpInsert
+	OperationUpdate   = event.OpUpdate
+	OperationDelete   = event.OpDelete
+	OperationTruncate = event.OpTruncate
+)
+
+var _oldReferenceRegexp = regexp.MustCompile(`(?i)\bOLD\s*\.`)
+
+type Table struct {
+	Name                 string        `yaml:"name"`
+	ChangedColumns       bool          `yaml:"changedColumns"`
+	Snapshot             bool          `yaml:"snapshot"`
+	Columns              ColumnsConfig `yaml:"columns"`
+	Operations           []string      `yaml:"operations"`
+	When                 string        `yaml:"when"`
+	SkipUnchangedUpdates bool          `yaml:"skipUnchangedUpdates"`
+
+	// Discovered from the database on setup, not configured
+	primaryKey []string
+}
+
+// Allows tables to be declared both as plain names and as objects with
+// per-table options
+func (t *Table) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := unmarshal(&t.Name); err == nil {
+		return nil
+	}
+
+	type table Table
+	return unmarshal((*table)(t))
+}
+
+// Splits the table name into its schema and relation name, the schema is
+// empty if the name is not qualified and is resolved by the search_path
+func (t *Table) SchemaAndRelation() (string, string) {
+	schema, relation, qualified := strings.Cut(t.Name, ".")
+	if !qualified {
+		return "", t.Name
+	}
+
+	return schema, relation
+}
+
+// Returns the table name with each part quoted, so it is safe to format into
+// queries and keeps the case of mixed case names
+func (t *Table) QuotedName() string {
+	schema, relation := t.SchemaAndRelation()
+	if schema == "" {
+		return pq.QuoteIdentifier(relation)
+	}
+
+	return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(relation)
+}
+
+func (t *Table) Validate() error {
+	parts := strings.Split(t.Name, ".")
+	if len(parts) > 2 || slices.Contains(parts, "") {
+		return fmt.Errorf("invalid table name [%s], expected [table] or [schema.table]", t.Name)
+	}
+
+	for _, operation := range t.Operations {
+		switch operation {
+		case OperationInsert, OperationUpdate, OperationDelete, OperationTruncate:
+			continue
+		}
+
+		return fmt.Errorf(
+			"invalid operation [%s] for table [%s], expected one of: [%s, %s, %s, %s]",
+			operation,
+			t.Name,
+			OperationInsert,
+			OperationUpdate,
+			OperationDelete,
+			OperationTruncate)
+	}
+
+	// Delete triggers only have OLD, and rewriting the condition would also
+	// touch string literals and quoted identifiers
+	if t.When != "" && slices.Contains(t.OperationsOrDefault(), OperationDelete) {
+		return fmt.Errorf(
+			"the when condition of table [%s] is not supported with the [%s] operation, remove it from operations",
+			t.Name,
+			OperationDelete)
+	}
+
+	// The when condition is written against NEW, OLD only exists for updates
+	if _oldReferenceRegexp.MatchString(t.When) && !slices.Equal(t.OperationsOrDefault(), []string{OperationUpdate}) {
+		return fmt.Errorf("the when condition of table [%s] can only reference OLD if operations is [%s]", t.Name, OperationUpdate)
+	}
+
+	return t.Columns.Validate()
+}
+
+func (t *Table) OperationsOrDefault() []string {
+	if len(t.Operations) == 0 {
+		return []string{OperationInsert, OperationUpdate, OperationDelete, OperationTruncate}
+	}
+
+	return t.Operations
+}
+
+// Returns the columns config as the JSON object understood by the row filter
+// function, which is empty if the columns are not filtered
+func (t *Table) ColumnsFilter() ([]byte, error) {
+	if !t.Columns.Enabled() {
+		return []byte("{}"), nil
+	}
+
+	columns := t.Columns
+	columns.TruncateLength = columns.TruncateLengthOrDefault()
+
+	return json.Marshal(columns)
+}
 
 type Config struct {
-	TimeoutSeconds uint64   `yaml:"timeoutSeconds"`
-	PollSeconds    uint64   `yaml:"pollSeconds"`
-	PollLimit      uint64   `yaml:"pollLimit"`
-	DSN            string   `yaml:"dsn"`
-	Tables         []string `yaml:"tables"`
+	TimeoutSeconds    uint64             `yaml:"timeoutSeconds"`
+	PollSeconds       uint64             `yaml:"pollSeconds"`
+	PollLimit         uint64             `yaml:"pollLimit"`
+	DSN               string             `yaml:"dsn"`
+	Tables            []Table            `yaml:"tables"`
+	SnapshotChunkSize uint64             `yaml:"snapshotChunkSize"`
+	EventSchema       string             `yaml:"eventSchema"`
+	EventTable        string             `yaml:"eventTable"`
+	NamePrefix        string             `yaml:"namePrefix"`
+	Unlogged          bool               `yaml:"unlogged"`
+	Replication       ReplicationConfig  `yaml:"replication"`
+	Coordination      CoordinationConfig `yaml:"coordination"`
+	Retention         RetentionConfig    `yaml:"retention"`
+	Batching          BatchingConfig     `yaml:"batching"`
+
+	// Tables to snapshot again even if a snapshot was already taken, set from
+	// the command line instead of the manifest
+	ForcedSnapshotTables []string `yaml:"-"`
 }
 
 func (c *Config) TimeoutSecondsOrDefault() time.Duration {
@@ -33,3 +371,27 @@ func (c *Config) LimitOrDefault() uint64 {
 
 	return c.PollLimit
 }
+
+func (c *Config) SnapshotChunkSizeOrDefault() uint64 {
+	if c.SnapshotChunkSize == 0 {
+		return 1000
+	}
+
+	return c.SnapshotChunkSize
+}
+
+func (c *Config) NamePrefixOrDefault() string {
+	if c.NamePrefix == "" {
+		return "from_to_"
+	}
+
+	return c.NamePrefix
+}
+
+func (c *Config) EventTableOrDefault() string {
+	if c.EventTable == "" {
+		return c.NamePrefixOrDefault() + "event"
+	}
+
+	return c.EventTable
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import "testing"
+
+func TestTableValidateWhen(t *testing.T) {
+	tests := []struct {
+		name  string
+		table Table
+		valid bool
+	}{
+		{"without when", Table{Name: "orders"}, true},
+		{"default operations", Table{Name: "orders", When: "NEW.status = 'paid'"}, false},
+		{"with deletes", Table{Name: "orders", When: "NEW.status = 'paid'", Operations: []string{"I", "D"}}, false},
+		{"without deletes", Table{Name: "orders", When: "NEW.status = 'paid'", Operations: []string{"I", "U", "T"}}, true},
+		{"old on updates", Table{Name: "orders", When: "OLD.status <> NEW.status", Operations: []string{"U"}}, true},
+		{"old on inserts", Table{Name: "orders", When: "OLD.status <> NEW.status", Operations: []string{"I", "U"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.table.Validate()
+			if test.valid && err != nil {
+				t.Errorf("expected the table to be valid, got error %s", err.Error())
+			}
+
+			if !test.valid && err == nil {
+				t.Error("expected the table to be invalid")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+func validateCoordinationMode(mode string) error {
+	switch mode {
+	case CoordinationModeNone, CoordinationModeLease, CoordinationModeLeader:
+		return nil
+	}
+
+	return fmt.Errorf(
+		"invalid coordination mode [%s], expected one of: [%s, %s, %s]",
+		mode,
+		CoordinationModeNone,
+		CoordinationModeLease,
+		CoordinationModeLeader)
+}
+
+// Returns whether this instance may process events. On leader mode only the
+// instance holding the advisory lock is the leader, the others stand by and
+// try to take over on every poll. The lock is held by a dedicated session, so
+// it is released by the server as soon as the leader connection is lost
+func (l *Listener) acquireLeadership(ctx context.Context) (bool, error) {
+	if l.coordinationMode != CoordinationModeLeader {
+		return true, nil
+	}
+
+	if l.leaderConn != nil {
+		pingCtx, cancel := context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+
+		if err := l.leaderConn.PingContext(pingCtx); err == nil {
+			return true, nil
+		}
+
+		l.logger.Warn("Lost leadership, leader connection is no longer alive")
+
+		l.leaderConn.Close()
+		l.leaderConn = nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, tryAdvisoryLockQuery, l.lockID).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+
+	if !acquired {
+		conn.Close()
+
+		l.logger.Debug("Another instance is the leader, standing by", "instance", l.instanceID)
+		return false, nil
+	}
+
+	l.leaderConn = conn
+	l.logger.Info("Elected as leader", "instance", l.instanceID, "lockId", l.lockID)
+
+	return true, nil
+}
+
+// Explicitly unlocks before returning the connection to the pool, otherwise
+// the session would keep holding the lock
+func (l *Listener) releaseLeadership() error {
+	if l.leaderConn == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	_, err := l.leaderConn.ExecContext(ctx, advisoryUnlockQuery, l.lockID)
+	if closeErr := l.leaderConn.Close(); err == nil {
+		err = closeErr
+	}
+
+	l.leaderConn = nil
+
+	return err
+}
+
+func (l *Listener) queryEventsToSend(ctx context.Context, limit uint64) (*sql.Rows, error) {
+	if l.coordinationMode == CoordinationModeLease {
+		return l.db.QueryContext(
+			ctx,
+			l.names.render(leaseEventsToSendQuery),
+			limit,
+			l.instanceID,
+			l.leaseDuration.Seconds())
+	}
+
+	return l.db.QueryContext(ctx, l.names.render(getEventsToSendQuery), limit)
+}
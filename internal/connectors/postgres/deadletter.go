@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func setupDeadLetterTable(db *sql.DB, names objectNames, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if names.schema != "" {
+		if _, err := db.ExecContext(ctx, names.render(setupEventSchemaQuery)); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.ExecContext(ctx, names.render(setupFromToDeadLetterTableQuery))
+	return err
+}
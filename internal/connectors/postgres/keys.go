@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// Loads the primary key columns of every table, so events can carry their
+// key. Tables without a primary key produce events without a key
+func setupPrimaryKeys(db *sql.DB, timeout time.Duration, tables map[string]Table, logger *slog.Logger) error {
+	for name, table := range tables {
+		primaryKey, err := getPrimaryKeyColumns(context.Background(), db, timeout, table)
+		if err != nil {
+			return err
+		}
+
+		if len(primaryKey) == 0 {
+			logger.Debug("Table does not have a primary key, its events have no key", "table", name)
+		}
+
+		table.primaryKey = primaryKey
+		tables[name] = table
+	}
+
+	return nil
+}
+
+func getPrimaryKeyColumns(ctx context.Context, db *sql.DB, timeout time.Duration, table Table) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, getPrimaryKeyColumnsQuery, table.QuotedName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
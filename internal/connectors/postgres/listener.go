@@ -7,29 +7,71 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/gustapinto/from-to/internal/connectors/eventtable"
 	"github.com/gustapinto/from-to/internal/event"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Listener struct {
 	dsn                    string
-	limit                  uint64
+	batchSizer             batchSizer
 	waitSeconds            time.Duration
 	timeout                time.Duration
 	db                     *sql.DB
+	notifications          *pq.Listener
 	logger                 *slog.Logger
 	tableToChannelRelation map[string][]event.Channel
+	tables                 map[string]Table
+	coordinationMode       string
+	instanceID             string
+	leaseDuration          time.Duration
+	lockID                 int64
+	leaderConn             *sql.Conn
+	snapshotChunkSize      uint64
+	pendingSnapshots       []string
+	retention              RetentionConfig
+	names                  objectNames
+	transactionMarkers     bool
+	ledger                 eventtable.Ledger
 }
 
 func NewListener(config Config, channels map[string]event.Channel) (*Listener, error) {
+	names := newObjectNames(config)
+
 	listener := &Listener{
 		dsn:         config.DSN,
-		limit:       config.LimitOrDefault(),
+		batchSizer:  newBatchSizer(config),
 		waitSeconds: config.PollSecondsOrDefault(),
 		timeout:     config.TimeoutSecondsOrDefault(),
 		logger:      slog.With("listener", "Postgres"),
+		tables:      make(map[string]Table, len(config.Tables)),
+
+		coordinationMode: config.Coordination.ModeOrDefault(),
+		instanceID:       config.Coordination.InstanceIDOrDefault(),
+		leaseDuration:    config.Coordination.LeaseSecondsOrDefault(),
+		lockID:           config.Coordination.LockIDOrDefault(names.notificationChannel),
+
+		snapshotChunkSize: config.SnapshotChunkSizeOrDefault(),
+		retention:         config.Retention,
+		names:             names,
+
+		transactionMarkers: event.UsesTransactionMarkers(channels),
+	}
+
+	for _, table := range config.Tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+
+		listener.tables[table.Name] = table
+	}
+
+	if err := validateCoordinationMode(listener.coordinationMode); err != nil {
+		return nil, err
 	}
 
 	if err := listener.connectToDatabase(config.DSN); err != nil {
@@ -40,38 +82,132 @@ func NewListener(config Config, channels map[string]event.Channel) (*Listener, e
 		return nil, err
 	}
 
-	listener.setupTableToChannelRelation(channels)
+	listener.setupUpcomingPartitions()
+
+	if err := setupPrimaryKeys(listener.db, listener.timeout, listener.tables, listener.logger); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupSnapshots(config); err != nil {
+		return nil, err
+	}
+
+	if err := listener.listenForNotifications(); err != nil {
+		return nil, err
+	}
+
+	if event.UsesDeadLetterTable(channels) {
+		if err := setupDeadLetterTable(listener.db, listener.names, listener.timeout); err != nil {
+			return nil, err
+		}
+
+		listener.logger.Debug("Dead letter table setup complete")
+	}
+
+	listener.ledger = eventtable.Ledger{
+		DB:                     listener.db,
+		Timeout:                listener.timeout,
+		Logger:                 listener.logger,
+		DeliveredChannelsQuery: listener.idListQuery(getDeliveredChannelsQuery),
+		SetEventsAsSentQuery:   listener.idListQuery(setEventsAsSentQuery),
+		SaveDeliveryQuery:      listener.names.render(saveDeliveryQuery),
+	}
+
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
 	listener.logger.Info("Connector setup completed")
 
 	return listener, nil
 }
 
-func (l *Listener) Listen(callback func(event.Event, []event.Channel) error) error {
-	limit := uint64(50)
+// Listens for events until ctx is done. A batch that already started is
+// always completed, so its events are not left half published
+func (l *Listener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	go l.runRetention(ctx)
 
 	for {
-		events, err := l.getEventsToSend(limit)
+		isLeader, err := l.acquireLeadership(ctx)
 		if err != nil {
 			return err
 		}
 
-		if len(events) > 0 {
-			l.logger.Info(fmt.Sprintf("Processing %d events", len(events)))
-		}
-
-		for _, e := range events {
-			if err := l.publishEvent(e, callback); err != nil {
+		if isLeader {
+			if err := l.snapshotPendingTables(ctx); err != nil {
 				return err
 			}
 
-			if err := l.setEventAsSent(e); err != nil {
+			if err := l.processUnsentEvents(ctx, callback); err != nil {
 				return err
 			}
 		}
 
+		if !l.waitForEvents(ctx) {
+			l.logger.Info("Listener stopped")
+			return nil
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return errors.Join(l.releaseLeadership(), l.notifications.Close(), l.db.Close())
+}
+
+func (l *Listener) processUnsentEvents(
+	ctx context.Context,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	for ctx.Err() == nil {
+		batchCtx := context.WithoutCancel(ctx)
+		limit := l.batchSizer.limit
+		start := time.Now()
+
+		events, err := l.getEventsToSend(batchCtx, limit)
+		if err != nil {
+			return err
+		}
+
+		if len(events) > 0 {
+			l.logger.Info(fmt.Sprintf("Processing %d events", len(events)))
+		}
+
+		allDone, err := l.ledger.PublishBatch(batchCtx, events, l.tableToChannelRelation, callback)
+		if err != nil {
+			return err
+		}
+
+		l.batchSizer.adjust(uint64(len(events)), time.Since(start))
+		if l.batchSizer.limit != limit {
+			l.logger.Debug("Adjusted batch size", "from", limit, "to", l.batchSizer.limit)
+		}
+
+		// A full batch means there may be more events waiting, so keep draining
+		// the backlog before going back to sleep. Undelivered events are kept
+		// in the backlog, so draining stops to avoid retrying them in a loop
+		if !allDone || uint64(len(events)) < limit {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Returns false if ctx is done before any new event arrives
+func (l *Listener) waitForEvents(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+
+	case <-l.notifications.Notify:
+		l.logger.Debug("Received event notification")
+
+	case <-time.After(l.waitSeconds):
 		l.logger.Info("Polling for new unsent events")
-		time.Sleep(l.waitSeconds)
 	}
+
+	return true
+}
+
+func (l *Listener) WriteDeadLetter(ctx context.Context, deadLetter event.DeadLetter) error {
+	return eventtable.WriteDeadLetter(ctx, l.db, l.names.render(insertDeadLetterQuery), l.timeout, deadLetter)
 }
 
 func (l *Listener) connectToDatabase(dsn string) error {
@@ -89,10 +225,26 @@ func (l *Listener) connectToDatabase(dsn string) error {
 	return nil
 }
 
-func (l *Listener) transaction(callback func(tx *sql.Tx) error) error {
+func (l *Listener) listenForNotifications() error {
+	l.notifications = pq.NewListener(l.dsn, time.Second, l.waitSeconds, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			l.logger.Warn("Notification listener error, falling back to polling", "error", err.Error())
+		}
+	})
+
+	if err := l.notifications.Listen(l.names.notificationChannel); err != nil {
+		return err
+	}
+
+	l.logger.Debug("Listening for notifications", "channel", l.names.notificationChannel)
+
+	return nil
+}
+
+func (l *Listener) transaction(ctx context.Context, callback func(tx *sql.Tx) error) error {
 	l.logger.Debug("Opening transaction")
 
-	tx, err := l.db.Begin()
+	tx, err := l.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -109,7 +261,7 @@ func (l *Listener) transaction(callback func(tx *sql.Tx) error) error {
 }
 
 func (l *Listener) setupDatabaseSchema(config Config) error {
-	return l.transaction(func(tx *sql.Tx) error {
+	return l.transaction(context.Background(), func(tx *sql.Tx) error {
 		if err := l.setupEventsTable(tx); err != nil {
 			return err
 		}
@@ -121,58 +273,88 @@ func (l *Listener) setupDatabaseSchema(config Config) error {
 				return err
 			}
 
-			l.logger.Debug("Table setup complete", "table", table)
+			l.logger.Debug("Table setup complete", "table", table.Name)
 		}
 
 		return nil
 	})
 }
 
-func (l *Listener) setupTableToChannelRelation(channels map[string]event.Channel) {
-	l.tableToChannelRelation = make(map[string][]event.Channel, len(channels))
-
-	for _, channel := range channels {
-		l.tableToChannelRelation[channel.From] = append(
-			l.tableToChannelRelation[channel.From],
-			channel,
-		)
+// Tables may be declared with either the schema qualified name or the bare
+// table name, the qualified name takes precedence
+func tableForEvent(tables map[string]Table, e event.Event) Table {
+	if table, ok := tables[e.QualifiedTable()]; ok {
+		return table
 	}
+
+	return tables[e.Table]
 }
 
 func (l *Listener) setupEventsTable(tx *sql.Tx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
 	defer cancel()
 
-	if _, err := tx.ExecContext(ctx, setupFromToEventTableQuery); err != nil {
+	if l.names.schema != "" {
+		if _, err := tx.ExecContext(ctx, l.names.render(setupEventSchemaQuery)); err != nil {
+			return err
+		}
+	}
+
+	if err := l.setupRetention(ctx, tx); err != nil {
 		return err
 	}
 
-	if _, err := tx.ExecContext(ctx, setupFromToProcessEventFunctionQuery); err != nil {
+	if _, err := tx.ExecContext(ctx, l.names.render(setupFromToEventTableQuery)); err != nil {
 		return err
 	}
 
-	return nil
-}
+	if err := l.setupPartitions(ctx, tx); err != nil {
+		return err
+	}
 
-func (l *Listener) setupTableTrigger(tx *sql.Tx, table string) error {
-	triggerName := fmt.Sprintf("from_to_%s_process_event_trigger", table)
-	query := fmt.Sprintf(setupTableTriggerPartialQuery, triggerName, table)
+	if _, err := tx.ExecContext(ctx, l.names.render(setupFromToFilterRowFunctionQuery)); err != nil {
+		return err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
-	defer cancel()
+	// Transactions are only tracked if some channel wants their markers, since
+	// it adds work to every captured change
+	transactionMarkers := "FALSE"
+	commitTriggerQuery := dropCommitTriggerQuery
+	if l.transactionMarkers {
+		transactionMarkers = "TRUE"
+		commitTriggerQuery = setupCommitTriggerQuery
+	}
 
-	if _, err := tx.ExecContext(ctx, query); err != nil {
-		return err
+	processEventFunctionQuery := strings.ReplaceAll(
+		l.names.render(setupFromToProcessEventFunctionQuery),
+		"{{transaction_markers}}",
+		transactionMarkers)
+
+	queries := []string{
+		processEventFunctionQuery,
+		l.names.render(setupFromToProcessCommitFunctionQuery),
+		l.names.render(commitTriggerQuery),
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (l *Listener) getEventsToSend(limit uint64) ([]event.Event, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+// Events are returned by id, which is taken when the trigger runs and not when
+// the transaction commits. Changes of the same row are serialized by its row
+// lock and the changes of a single transaction keep their statement order, but
+// concurrent transactions may commit in a different order than their ids, so
+// an event can become visible after later ids were already sent
+func (l *Listener) getEventsToSend(ctx context.Context, limit uint64) ([]event.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
 	defer cancel()
 
-	rows, err := l.db.QueryContext(ctx, getEventsToSendQuery, limit)
+	rows, err := l.queryEventsToSend(ctx, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -181,49 +363,73 @@ func (l *Listener) getEventsToSend(limit uint64) ([]event.Event, error) {
 	var events []event.Event
 	for rows.Next() {
 		var e event.Event
-		var data []byte
-		if err := rows.Scan(&e.ID, &e.Op, &e.Table, &data, &e.Ts, &e.Sent); err != nil {
+		var data, before []byte
+		var timestamp sql.NullTime
+		var txID, txSeq sql.NullInt64
+		err := rows.Scan(
+			&e.ID,
+			&e.Op,
+			&e.Schema,
+			&e.Table,
+			&data,
+			&before,
+			&e.Ts,
+			&timestamp,
+			&txID,
+			&txSeq,
+			&e.Sent)
+		if err != nil {
 			return nil, err
 		}
 
-		if err := json.Unmarshal(data, &e.Row); err != nil {
-			return nil, err
-		}
+		e.Timestamp = timestamp.Time
+		e.TxID = uint64(txID.Int64)
+		e.TxSeq = uint64(txSeq.Int64)
 
-		events = append(events, e)
-	}
+		table := tableForEvent(l.tables, e)
 
-	return events, nil
-}
+		// Truncate events do not carry any row
+		if data != nil {
+			if err := json.Unmarshal(data, &e.Row); err != nil {
+				return nil, err
+			}
 
-func (l *Listener) setEventAsSent(e event.Event) error {
-	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
-	defer cancel()
+			e.Key = event.KeyFromRow(table.primaryKey, e.Row)
+		}
 
-	if _, err := l.db.ExecContext(ctx, setEventAsSentQuery, e.ID); err != nil {
-		return err
+		if before != nil {
+			if err := json.Unmarshal(before, &e.Before); err != nil {
+				return nil, err
+			}
+
+			if table.ChangedColumns {
+				e.Changed = event.ChangedColumns(e.Before, e.Row)
+			}
+		}
+
+		events = append(events, e)
 	}
 
-	l.logger.Debug("Marked event as sent", "event", e)
+	// UPDATE ... RETURNING does not keep the order of the leased rows
+	if l.coordinationMode == CoordinationModeLease {
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].ID < events[j].ID
+		})
+	}
 
-	return nil
+	return events, nil
 }
 
-func (l *Listener) publishEvent(e event.Event, callback func(event.Event, []event.Channel) error) error {
-	l.logger.Debug("Publishing event", "event", e)
-	l.logger.Debug("Getting channels to publish")
-
-	channels, ok := l.tableToChannelRelation[e.Table]
-	if !ok {
-		l.logger.Warn("Table does not have any configured channel, skipping", "id", e.ID, "table", e.Table)
-		return nil
-	}
+// Builds a query that takes the ids as a BIGINT array
+func (l *Listener) idListQuery(query string) func(ids []uint64) (string, []any) {
+	query = l.names.render(query)
 
-	l.logger.Debug("Calling publish event callback", "event", e, "channels", channels)
+	return func(ids []uint64) (string, []any) {
+		array := make([]int64, 0, len(ids))
+		for _, id := range ids {
+			array = append(array, int64(id))
+		}
 
-	if err := callback(e, channels); err != nil {
-		return fmt.Errorf("Failed to publish event, got error %s", err.Error())
+		return query, []any{pq.Array(array)}
 	}
-
-	return nil
 }
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Maintenance plans and applies changes to the objects installed by the
+// trigger based listener, such as triggers left behind by tables that were
+// removed from the manifest
+type Maintenance struct {
+	db      *sql.DB
+	timeout time.Duration
+	tables  []Table
+	names   objectNames
+	logger  *slog.Logger
+}
+
+type installedTrigger struct {
+	tableOID uint32
+	schema   string
+	table    string
+	name     string
+}
+
+func NewMaintenance(config Config) (*Maintenance, error) {
+	maintenance := &Maintenance{
+		timeout: config.TimeoutSecondsOrDefault(),
+		tables:  config.Tables,
+		names:   newObjectNames(config),
+		logger:  slog.With("maintenance", "Postgres"),
+	}
+
+	for _, table := range config.Tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("postgres", config.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	maintenance.db = db
+
+	return maintenance, nil
+}
+
+func (m *Maintenance) Close() error {
+	return m.db.Close()
+}
+
+// Returns the statements that drop the installed triggers whose table is no
+// longer listed on the manifest
+func (m *Maintenance) SyncTriggersStatements(ctx context.Context) ([]string, error) {
+	triggers, err := m.getInstalledTriggers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestTables := make(map[uint32]string, len(m.tables))
+	for _, table := range m.tables {
+		oid, err := m.getTableOID(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+
+		if oid == 0 {
+			m.logger.Warn("Table listed on the manifest does not exist", "table", table.Name)
+			continue
+		}
+
+		manifestTables[oid] = table.Name
+	}
+
+	installedTables := make(map[uint32]bool, len(triggers))
+	var statements []string
+	for _, trigger := range triggers {
+		installedTables[trigger.tableOID] = true
+
+		if _, listed := manifestTables[trigger.tableOID]; listed {
+			continue
+		}
+
+		m.logger.Info("Found orphan trigger", "trigger", trigger.name, "table", trigger.schema+"."+trigger.table)
+		statements = append(statements, trigger.dropStatement())
+	}
+
+	for oid, table := range manifestTables {
+		if !installedTables[oid] {
+			m.logger.Warn("Table listed on the manifest has no trigger, it is installed on the next start", "table", table)
+		}
+	}
+
+	return statements, nil
+}
+
+// Returns the statements that drop every installed trigger and the trigger
+// functions, and optionally the event table and its companion tables
+func (m *Maintenance) UninstallStatements(ctx context.Context, dropEventTable bool) ([]string, error) {
+	triggers, err := m.getInstalledTriggers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(triggers)+2)
+	for _, trigger := range triggers {
+		statements = append(statements, trigger.dropStatement())
+	}
+
+	statements = append(statements, m.names.render(dropFunctionsQuery))
+
+	if dropEventTable {
+		statements = append(statements, m.names.render(dropTablesQuery))
+	}
+
+	return statements, nil
+}
+
+// Executes the statements in a single transaction, so a failure leaves the
+// database untouched
+func (m *Maintenance) Apply(ctx context.Context, statements []string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		m.logger.Info("Executing statement", "statement", statement)
+
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			if rollErr := tx.Rollback(); rollErr != nil {
+				return rollErr
+			}
+
+			return fmt.Errorf("failed to execute [%s], got error %s", statement, err.Error())
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *Maintenance) getInstalledTriggers(ctx context.Context) ([]installedTrigger, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, m.names.render(getInstalledTriggersQuery))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var triggers []installedTrigger
+	for rows.Next() {
+		var trigger installedTrigger
+		if err := rows.Scan(&trigger.tableOID, &trigger.schema, &trigger.table, &trigger.name); err != nil {
+			return nil, err
+		}
+
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers, rows.Err()
+}
+
+// Returns zero if the table does not exist
+func (m *Maintenance) getTableOID(ctx context.Context, table Table) (uint32, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var oid sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, getTableOIDQuery, table.QuotedName()).Scan(&oid); err != nil {
+		return 0, err
+	}
+
+	return uint32(oid.Int64), nil
+}
+
+func (t *installedTrigger) dropStatement() string {
+	return fmt.Sprintf(
+		dropTriggerPartialQuery,
+		pq.QuoteIdentifier(t.name),
+		pq.QuoteIdentifier(t.schema)+"."+pq.QuoteIdentifier(t.table))
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var _invalidSettingCharsRegexp = regexp.MustCompile(`[^a-z0-9_]`)
+
+// Names of the objects created on the database, every query is written with
+// placeholders for them, so deployments with different names can share it
+type objectNames struct {
+	schema              string
+	prefix              string
+	eventTable          string
+	notificationChannel string
+	unlogged            bool
+	replacer            *strings.Replacer
+}
+
+func newObjectNames(config Config) objectNames {
+	names := objectNames{
+		schema:              config.EventSchema,
+		prefix:              config.NamePrefixOrDefault(),
+		eventTable:          config.EventTableOrDefault(),
+		notificationChannel: config.EventTableOrDefault(),
+		unlogged:            config.Unlogged,
+	}
+
+	if names.schema != "" {
+		names.notificationChannel = names.schema + "." + names.eventTable
+	}
+
+	unlogged := ""
+	if names.unlogged {
+		unlogged = "UNLOGGED "
+	}
+
+	names.replacer = strings.NewReplacer(
+		"{{schema}}", pq.QuoteIdentifier(names.schema),
+		"{{event}}", names.qualify(names.eventTable),
+		"{{event_literal}}", pq.QuoteLiteral(names.qualify(names.eventTable)),
+		"{{event_default}}", names.qualify(names.eventTable+"_default"),
+		"{{partition_prefix_literal}}", pq.QuoteLiteral(names.partitionPrefix()+"%"),
+		"{{delivery}}", names.qualify(names.eventTable+"_delivery"),
+		"{{archive}}", names.qualify(names.eventTable+"_archive"),
+		"{{snapshot}}", names.qualify(names.prefix+"snapshot"),
+		"{{dead_letter}}", names.qualify(names.prefix+"dead_letter"),
+		"{{function}}", names.qualify(names.prefix+"process_event"),
+		"{{filter_row}}", names.qualify(names.prefix+"filter_row"),
+		"{{function_literal}}", pq.QuoteLiteral(names.qualify(names.prefix+"process_event")+"()"),
+		"{{commit_function}}", names.qualify(names.prefix+"process_commit"),
+		"{{commit_trigger}}", pq.QuoteIdentifier(names.prefix+"commit_trigger"),
+		"{{tx_seq_setting_literal}}", pq.QuoteLiteral(names.setting("tx_seq")),
+		"{{tx_tables_setting_literal}}", pq.QuoteLiteral(names.setting("tx_tables")),
+		"{{notification_channel_literal}}", pq.QuoteLiteral(names.notificationChannel),
+		"{{unlogged}}", unlogged,
+	)
+
+	return names
+}
+
+// Replaces the object name placeholders of the query
+func (n *objectNames) render(query string) string {
+	return n.replacer.Replace(query)
+}
+
+// Returns the quoted name of an object, qualified by the configured schema
+func (n *objectNames) qualify(name string) string {
+	if n.schema == "" {
+		return pq.QuoteIdentifier(name)
+	}
+
+	return pq.QuoteIdentifier(n.schema) + "." + pq.QuoteIdentifier(name)
+}
+
+// Returns the name of a transaction local setting, which must be a valid
+// identifier qualified by a custom prefix
+func (n *objectNames) setting(name string) string {
+	return "from_to." + _invalidSettingCharsRegexp.ReplaceAllString(
+		strings.ToLower(n.notificationChannel+"_"+name),
+		"_")
+}
+
+func (n *objectNames) partitionPrefix() string {
+	return n.eventTable + "_p"
+}
+
+// The operation comes before the table name, so triggers of long table names
+// that are truncated by the server still have distinct names
+func (n *objectNames) triggerName(operation string, relation string) string {
+	return n.prefix + strings.ToLower(_triggerEvents[operation]) + "_" + relation + "_trigger"
+}
+
+// Name of the trigger that captured every operation at once, created before
+// triggers were split by operation
+func (n *objectNames) legacyTriggerName(relation string) string {
+	return n.prefix + relation + "_process_event_trigger"
+}
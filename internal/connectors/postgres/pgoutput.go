@@ -0,0 +1,549 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_xLogDataByteID                = 'w'
+	_primaryKeepaliveMessageByteID = 'k'
+	_standbyStatusUpdateByteID     = 'r'
+
+	_pgoutputBegin    = 'B'
+	_pgoutputCommit   = 'C'
+	_pgoutputRelation = 'R'
+	_pgoutputInsert   = 'I'
+	_pgoutputUpdate   = 'U'
+	_pgoutputDelete   = 'D'
+	_pgoutputTruncate = 'T'
+
+	_tupleNull           = 'n'
+	_tupleUnchangedToast = 'u'
+	_tupleText           = 't'
+	_tupleNew            = 'N'
+	_tupleKey            = 'K'
+	_tupleOld            = 'O'
+)
+
+// Postgres replication timestamps are expressed as microseconds since 2000-01-01
+var _postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type lsn uint64
+
+func (l lsn) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+func parseLSN(s string) (lsn, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	var upper, lower uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &upper, &lower); err != nil {
+		return 0, fmt.Errorf("failed to parse LSN [%s], got error %s", s, err.Error())
+	}
+
+	return lsn(uint64(upper)<<32 | uint64(lower)), nil
+}
+
+type xLogData struct {
+	walStart lsn
+	walEnd   lsn
+	data     []byte
+}
+
+type primaryKeepalive struct {
+	walEnd         lsn
+	replyRequested bool
+}
+
+type relationColumn struct {
+	name    string
+	typeOID uint32
+}
+
+type relation struct {
+	id        uint32
+	namespace string
+	name      string
+	columns   []relationColumn
+}
+
+type beginMessage struct {
+	finalLSN   lsn
+	commitTime time.Time
+	xid        uint32
+}
+
+type commitMessage struct {
+	commitLSN  lsn
+	endLSN     lsn
+	commitTime time.Time
+}
+
+type tupleColumn struct {
+	kind  byte
+	value []byte
+}
+
+type rowMessage struct {
+	op           byte
+	relationID   uint32
+	oldTupleKind byte
+	oldTuple     []tupleColumn
+	newTuple     []tupleColumn
+}
+
+type truncateMessage struct {
+	relationIDs []uint32
+}
+
+type messageReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *messageReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if r.offset+n > len(r.data) {
+		r.err = errors.New("unexpected end of replication message")
+		return nil
+	}
+
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+
+	return b
+}
+
+func (r *messageReader) byte() byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (r *messageReader) uint16() uint16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *messageReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *messageReader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *messageReader) timestamp() time.Time {
+	return _postgresEpoch.Add(time.Duration(int64(r.uint64())) * time.Microsecond)
+}
+
+func (r *messageReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+
+	end := bytes.IndexByte(r.data[r.offset:], 0)
+	if end < 0 {
+		r.err = errors.New("unterminated string in replication message")
+		return ""
+	}
+
+	s := string(r.data[r.offset : r.offset+end])
+	r.offset += end + 1
+
+	return s
+}
+
+func (r *messageReader) tuple() []tupleColumn {
+	columns := make([]tupleColumn, r.uint16())
+	for i := range columns {
+		columns[i].kind = r.byte()
+		if columns[i].kind == _tupleText {
+			columns[i].value = r.take(int(r.uint32()))
+		}
+	}
+
+	return columns
+}
+
+func parseXLogData(data []byte) (xLogData, error) {
+	r := messageReader{data: data}
+	xld := xLogData{
+		walStart: lsn(r.uint64()),
+		walEnd:   lsn(r.uint64()),
+	}
+	r.uint64() // server time
+
+	xld.data = data[r.offset:]
+
+	return xld, r.err
+}
+
+func parsePrimaryKeepalive(data []byte) (primaryKeepalive, error) {
+	r := messageReader{data: data}
+	pk := primaryKeepalive{
+		walEnd: lsn(r.uint64()),
+	}
+	r.uint64() // server time
+	pk.replyRequested = r.byte() == 1
+
+	return pk, r.err
+}
+
+func encodeStandbyStatusUpdate(flushed lsn, now time.Time) []byte {
+	data := make([]byte, 0, 34)
+	data = append(data, _standbyStatusUpdateByteID)
+	data = binary.BigEndian.AppendUint64(data, uint64(flushed)) // write
+	data = binary.BigEndian.AppendUint64(data, uint64(flushed)) // flush
+	data = binary.BigEndian.AppendUint64(data, uint64(flushed)) // apply
+	data = binary.BigEndian.AppendUint64(data, uint64(now.Sub(_postgresEpoch).Microseconds()))
+	data = append(data, 0)
+
+	return data
+}
+
+func parseBegin(data []byte) (beginMessage, error) {
+	r := messageReader{data: data, offset: 1}
+
+	return beginMessage{
+		finalLSN:   lsn(r.uint64()),
+		commitTime: r.timestamp(),
+		xid:        r.uint32(),
+	}, r.err
+}
+
+func parseCommit(data []byte) (commitMessage, error) {
+	r := messageReader{data: data, offset: 1}
+	r.byte() // flags
+
+	return commitMessage{
+		commitLSN:  lsn(r.uint64()),
+		endLSN:     lsn(r.uint64()),
+		commitTime: r.timestamp(),
+	}, r.err
+}
+
+func parseRelation(data []byte) (relation, error) {
+	r := messageReader{data: data, offset: 1}
+	rel := relation{
+		id:        r.uint32(),
+		namespace: r.string(),
+		name:      r.string(),
+	}
+	r.byte() // replica identity
+
+	rel.columns = make([]relationColumn, r.uint16())
+	for i := range rel.columns {
+		r.byte() // flags
+		rel.columns[i].name = r.string()
+		rel.columns[i].typeOID = r.uint32()
+		r.uint32() // type modifier
+	}
+
+	return rel, r.err
+}
+
+func parseRowMessage(data []byte) (rowMessage, error) {
+	r := messageReader{data: data, offset: 1}
+	msg := rowMessage{
+		op:         data[0],
+		relationID: r.uint32(),
+	}
+
+	for r.err == nil && r.offset < len(r.data) {
+		switch kind := r.byte(); kind {
+		case _tupleKey, _tupleOld:
+			msg.oldTupleKind = kind
+			msg.oldTuple = r.tuple()
+		case _tupleNew:
+			msg.newTuple = r.tuple()
+		default:
+			return msg, fmt.Errorf("unexpected tuple type [%c] in replication message", kind)
+		}
+	}
+
+	if r.err == nil && msg.oldTuple == nil && msg.newTuple == nil {
+		return msg, errors.New("replication message does not have any tuple")
+	}
+
+	return msg, r.err
+}
+
+func parseTruncate(data []byte) (truncateMessage, error) {
+	r := messageReader{data: data, offset: 1}
+	msg := truncateMessage{
+		relationIDs: make([]uint32, r.uint32()),
+	}
+	r.byte() // options
+
+	for i := range msg.relationIDs {
+		msg.relationIDs[i] = r.uint32()
+	}
+
+	return msg, r.err
+}
+
+// Converts a tuple to the representation to_jsonb produces on the trigger
+// input, see decodeTextValue for the differences. Unchanged TOAST values are
+// not sent by the server, they are taken from before when it has them and
+// returned as unchanged otherwise
+func (rel *relation) tupleToRow(tuple []tupleColumn, before map[string]any) (map[string]any, []string, error) {
+	if tuple == nil {
+		return nil, nil, nil
+	}
+
+	if len(tuple) != len(rel.columns) {
+		return nil, nil, fmt.Errorf(
+			"relation [%s] has %d columns but tuple has %d",
+			rel.name,
+			len(rel.columns),
+			len(tuple))
+	}
+
+	var unchanged []string
+	row := make(map[string]any, len(tuple))
+	for i, column := range tuple {
+		name := rel.columns[i].name
+
+		switch column.kind {
+		case _tupleNull:
+			row[name] = nil
+		case _tupleText:
+			value, err := decodeTextValue(rel.columns[i].typeOID, string(column.value))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			row[name] = value
+		case _tupleUnchangedToast:
+			if value, ok := before[name]; ok {
+				row[name] = value
+			} else {
+				unchanged = append(unchanged, name)
+			}
+		}
+	}
+
+	return row, unchanged, nil
+}
+
+// Element types of the array types decoded into JSON arrays, arrays of other
+// types are kept as their text literal
+var _arrayElementTypes = map[uint32]uint32{
+	1000: 16,   // bool[]
+	1005: 21,   // int2[]
+	1007: 23,   // int4[]
+	1016: 20,   // int8[]
+	1028: 26,   // oid[]
+	1021: 700,  // float4[]
+	1022: 701,  // float8[]
+	1231: 1700, // numeric[]
+	199:  114,  // json[]
+	3807: 3802, // jsonb[]
+	1115: 1114, // timestamp[]
+	1185: 1184, // timestamptz[]
+	1009: 25,   // text[]
+	1015: 1043, // varchar[]
+	1014: 1042, // bpchar[]
+	1182: 1082, // date[]
+	2951: 2950, // uuid[]
+}
+
+// Decodes the text output of a column into the value to_jsonb produces for it.
+// Values differ from the trigger input in that arrays of types missing from
+// _arrayElementTypes stay as text literals, and timestamptz offsets follow the
+// time zone of the replication connection instead of the writing session
+func decodeTextValue(typeOID uint32, value string) (any, error) {
+	if elementOID, isArray := _arrayElementTypes[typeOID]; isArray {
+		return decodeArrayValue(elementOID, value)
+	}
+
+	switch typeOID {
+	case 16: // bool
+		return value == "t", nil
+	case 20, 21, 23, 26, 700, 701, 1700: // int8, int2, int4, oid, float4, float8, numeric
+		// NaN, Infinity and numerics out of the float64 range can not be
+		// encoded as JSON numbers, so they are kept as strings like to_jsonb
+		// does
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return value, nil
+		}
+
+		return number, nil
+	case 114, 3802: // json, jsonb
+		var decoded any
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			return nil, err
+		}
+
+		return decoded, nil
+	case 1114: // timestamp
+		return strings.Replace(value, " ", "T", 1), nil
+	case 1184: // timestamptz
+		return normalizeTimestamptz(value), nil
+	default:
+		return value, nil
+	}
+}
+
+// Text output writes offsets as +HH when they have no minutes, JSON output
+// always writes +HH:MM
+func normalizeTimestamptz(value string) string {
+	if strings.HasSuffix(value, " BC") || !strings.Contains(value, " ") {
+		return value
+	}
+
+	value = strings.Replace(value, " ", "T", 1)
+
+	sign := strings.LastIndexAny(value, "+-")
+	if sign > strings.IndexByte(value, 'T') && len(value)-sign == 3 {
+		value += ":00"
+	}
+
+	return value
+}
+
+// Parses an array literal such as {1,NULL,"a,b"} or {{1,2},{3,4}}, decoding
+// each element as a value of the element type
+func decodeArrayValue(elementOID uint32, value string) (any, error) {
+	// Arrays with lower bounds other than 1 are prefixed by their dimensions,
+	// such as [0:1]={1,2}, which JSON arrays can not keep
+	if strings.HasPrefix(value, "[") {
+		_, value, _ = strings.Cut(value, "=")
+	}
+
+	p := arrayParser{value: value, elementOID: elementOID}
+	array, err := p.array()
+	if err == nil && p.offset != len(p.value) {
+		err = errors.New("unexpected data after the array")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode array [%s], got error %s", value, err.Error())
+	}
+
+	return array, nil
+}
+
+type arrayParser struct {
+	value      string
+	offset     int
+	elementOID uint32
+}
+
+func (p *arrayParser) array() ([]any, error) {
+	if p.offset >= len(p.value) || p.value[p.offset] != '{' {
+		return nil, errors.New("expected {")
+	}
+
+	p.offset++
+
+	array := []any{}
+	if p.offset < len(p.value) && p.value[p.offset] == '}' {
+		p.offset++
+		return array, nil
+	}
+
+	for {
+		element, err := p.element()
+		if err != nil {
+			return nil, err
+		}
+
+		array = append(array, element)
+
+		if p.offset >= len(p.value) {
+			return nil, errors.New("unterminated array")
+		}
+
+		switch p.value[p.offset] {
+		case ',':
+			p.offset++
+		case '}':
+			p.offset++
+			return array, nil
+		default:
+			return nil, fmt.Errorf("unexpected character %q", p.value[p.offset])
+		}
+	}
+}
+
+func (p *arrayParser) element() (any, error) {
+	if p.offset >= len(p.value) {
+		return nil, errors.New("unterminated array")
+	}
+
+	switch p.value[p.offset] {
+	case '{':
+		return p.array()
+
+	case '"':
+		p.offset++
+
+		var element strings.Builder
+		for p.offset < len(p.value) {
+			c := p.value[p.offset]
+			p.offset++
+
+			switch {
+			case c == '\\' && p.offset < len(p.value):
+				element.WriteByte(p.value[p.offset])
+				p.offset++
+			case c == '"':
+				return decodeTextValue(p.elementOID, element.String())
+			default:
+				element.WriteByte(c)
+			}
+		}
+
+		return nil, errors.New("unterminated quoted element")
+	}
+
+	end := strings.IndexAny(p.value[p.offset:], ",}")
+	if end < 0 {
+		return nil, errors.New("unterminated array")
+	}
+
+	element := strings.TrimSpace(p.value[p.offset : p.offset+end])
+	p.offset += end
+
+	// Only unquoted NULLs are nulls, "NULL" is a string
+	if strings.EqualFold(element, "NULL") {
+		return nil, nil
+	}
+
+	return decodeTextValue(p.elementOID, element)
+}
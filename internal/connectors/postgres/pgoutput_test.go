@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Messages as sent by pgoutput for:
+//
+//	CREATE TABLE public.sales (id int4, description text, total numeric);
+//	INSERT INTO sales VALUES (1, 'first', 10.5);
+//	UPDATE sales SET total = 'NaN' WHERE id = 1; -- REPLICA IDENTITY FULL
+//	TRUNCATE sales, customers;
+var (
+	_relationMessage = []byte{
+		'R',
+		0x00, 0x00, 0x40, 0x00, // relation id 16384
+		'p', 'u', 'b', 'l', 'i', 'c', 0x00,
+		's', 'a', 'l', 'e', 's', 0x00,
+		'f',        // replica identity
+		0x00, 0x03, // columns
+		0x01, 'i', 'd', 0x00, 0x00, 0x00, 0x00, 0x17, 0xff, 0xff, 0xff, 0xff,
+		0x00, 'd', 'e', 's', 'c', 'r', 'i', 'p', 't', 'i', 'o', 'n', 0x00, 0x00, 0x00, 0x00, 0x19, 0xff, 0xff, 0xff, 0xff,
+		0x00, 't', 'o', 't', 'a', 'l', 0x00, 0x00, 0x00, 0x06, 0xa4, 0xff, 0xff, 0xff, 0xff,
+	}
+
+	_insertMessage = []byte{
+		'I',
+		0x00, 0x00, 0x40, 0x00,
+		'N',
+		0x00, 0x03,
+		't', 0x00, 0x00, 0x00, 0x01, '1',
+		't', 0x00, 0x00, 0x00, 0x05, 'f', 'i', 'r', 's', 't',
+		't', 0x00, 0x00, 0x00, 0x04, '1', '0', '.', '5',
+	}
+
+	_updateMessage = []byte{
+		'U',
+		0x00, 0x00, 0x40, 0x00,
+		'O',
+		0x00, 0x03,
+		't', 0x00, 0x00, 0x00, 0x01, '1',
+		't', 0x00, 0x00, 0x00, 0x05, 'f', 'i', 'r', 's', 't',
+		't', 0x00, 0x00, 0x00, 0x04, '1', '0', '.', '5',
+		'N',
+		0x00, 0x03,
+		't', 0x00, 0x00, 0x00, 0x01, '1',
+		'u',
+		't', 0x00, 0x00, 0x00, 0x03, 'N', 'a', 'N',
+	}
+
+	_truncateMessage = []byte{
+		'T',
+		0x00, 0x00, 0x00, 0x02, // relations
+		0x00, // options
+		0x00, 0x00, 0x40, 0x00,
+		0x00, 0x00, 0x40, 0x01,
+	}
+)
+
+func TestParseLSN(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected lsn
+	}{
+		{"", 0},
+		{"0/0", 0},
+		{"16/B374D848", lsn(0x16_B374D848)},
+		{"FFFFFFFF/FFFFFFFF", lsn(^uint64(0))},
+	}
+
+	for _, test := range tests {
+		actual, err := parseLSN(test.input)
+		if err != nil {
+			t.Fatalf("parseLSN(%q) returned error %s", test.input, err.Error())
+		}
+
+		if actual != test.expected {
+			t.Errorf("parseLSN(%q) = %d, expected %d", test.input, actual, test.expected)
+		}
+
+		if test.input != "" && actual.String() != test.input {
+			t.Errorf("lsn(%d).String() = %s, expected %s", actual, actual.String(), test.input)
+		}
+	}
+
+	if _, err := parseLSN("not an lsn"); err == nil {
+		t.Error("parseLSN of an invalid LSN should return an error")
+	}
+}
+
+func TestParseBeginAndCommit(t *testing.T) {
+	begin, err := parseBegin([]byte{
+		'B',
+		0x00, 0x00, 0x00, 0x16, 0xb3, 0x74, 0xd8, 0x48, // final lsn
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x0f, 0x42, 0x40, // one second after the epoch
+		0x00, 0x00, 0x02, 0xe7, // xid 743
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if begin.finalLSN != lsn(0x16_B374D848) || begin.xid != 743 {
+		t.Errorf("unexpected begin message %+v", begin)
+	}
+
+	if !begin.commitTime.Equal(_postgresEpoch.Add(time.Second)) {
+		t.Errorf("unexpected commit time %s", begin.commitTime)
+	}
+
+	commit, err := parseCommit([]byte{
+		'C',
+		0x00,
+		0x00, 0x00, 0x00, 0x16, 0xb3, 0x74, 0xd8, 0x48,
+		0x00, 0x00, 0x00, 0x16, 0xb3, 0x74, 0xd8, 0x78,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x0f, 0x42, 0x40,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commit.commitLSN != lsn(0x16_B374D848) || commit.endLSN != lsn(0x16_B374D878) {
+		t.Errorf("unexpected commit message %+v", commit)
+	}
+}
+
+func TestParseRelation(t *testing.T) {
+	rel, err := parseRelation(_relationMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := relation{
+		id:        16384,
+		namespace: "public",
+		name:      "sales",
+		columns: []relationColumn{
+			{name: "id", typeOID: 23},
+			{name: "description", typeOID: 25},
+			{name: "total", typeOID: 1700},
+		},
+	}
+
+	if !reflect.DeepEqual(rel, expected) {
+		t.Errorf("parseRelation() = %+v, expected %+v", rel, expected)
+	}
+}
+
+func TestParseRowMessage(t *testing.T) {
+	rel, err := parseRelation(_relationMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert, err := parseRowMessage(_insertMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, unchanged, err := rel.tupleToRow(insert.newTuple, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{"id": float64(1), "description": "first", "total": 10.5}
+	if !reflect.DeepEqual(row, expected) || unchanged != nil {
+		t.Errorf("insert row = %v (unchanged %v), expected %v", row, unchanged, expected)
+	}
+
+	update, err := parseRowMessage(_updateMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update.oldTupleKind != _tupleOld {
+		t.Errorf("unexpected old tuple kind %c", update.oldTupleKind)
+	}
+
+	before, _, err := rel.tupleToRow(update.oldTuple, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, unchanged, err = rel.tupleToRow(update.newTuple, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = map[string]any{"id": float64(1), "description": "first", "total": "NaN"}
+	if !reflect.DeepEqual(row, expected) || unchanged != nil {
+		t.Errorf("update row = %v (unchanged %v), expected %v", row, unchanged, expected)
+	}
+
+	// Without the before image the unchanged TOAST value can not be filled
+	row, unchanged, err = rel.tupleToRow(update.newTuple, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := row["description"]; ok || !reflect.DeepEqual(unchanged, []string{"description"}) {
+		t.Errorf("update row without before = %v (unchanged %v)", row, unchanged)
+	}
+
+	if _, _, err := rel.tupleToRow(update.newTuple[:2], nil); err == nil {
+		t.Error("tupleToRow with a missing column should return an error")
+	}
+}
+
+func TestParseRowMessageTruncated(t *testing.T) {
+	for i := 1; i < len(_insertMessage); i++ {
+		if _, err := parseRowMessage(_insertMessage[:i]); err == nil {
+			t.Errorf("parseRowMessage of %d bytes should return an error", i)
+		}
+	}
+}
+
+func TestParseTruncate(t *testing.T) {
+	truncate, err := parseTruncate(_truncateMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(truncate.relationIDs, []uint32{16384, 16385}) {
+		t.Errorf("unexpected truncated relations %v", truncate.relationIDs)
+	}
+}
+
+func TestDecodeTextValue(t *testing.T) {
+	tests := []struct {
+		typeOID  uint32
+		value    string
+		expected any
+	}{
+		{16, "t", true},
+		{16, "f", false},
+		{23, "-42", float64(-42)},
+		{701, "1.5", 1.5},
+		{701, "NaN", "NaN"},
+		{701, "Infinity", "Infinity"},
+		{701, "-Infinity", "-Infinity"},
+		{1700, "NaN", "NaN"},
+		{1700, "1e400", "1e400"},
+		{3802, `{"a": [1, "b"]}`, map[string]any{"a": []any{float64(1), "b"}}},
+		{1114, "2025-01-02 03:04:05.123", "2025-01-02T03:04:05.123"},
+		{1184, "2025-01-02 03:04:05+00", "2025-01-02T03:04:05+00:00"},
+		{1184, "2025-01-02 03:04:05.5-03", "2025-01-02T03:04:05.5-03:00"},
+		{1184, "2025-01-02 03:04:05+05:30", "2025-01-02T03:04:05+05:30"},
+		{1184, "infinity", "infinity"},
+		{25, "some text", "some text"},
+		{1007, "{1,2,NULL}", []any{float64(1), float64(2), nil}},
+		{1007, "{{1,2},{3,4}}", []any{[]any{float64(1), float64(2)}, []any{float64(3), float64(4)}}},
+		{1007, "[0:1]={5,6}", []any{float64(5), float64(6)}},
+		{1009, "{}", []any{}},
+		{1009, `{plain,"a,b","with \"quotes\"","NULL",NULL}`, []any{"plain", "a,b", `with "quotes"`, "NULL", nil}},
+		{1000, "{t,f}", []any{true, false}},
+		{1231, "{1.5,NaN}", []any{1.5, "NaN"}},
+		{3807, `{"{\"a\": 1}"}`, []any{map[string]any{"a": float64(1)}}},
+		{1185, `{"2025-01-02 03:04:05+00"}`, []any{"2025-01-02T03:04:05+00:00"}},
+		{1561, "{1,0}", "{1,0}"}, // bit[] is not decoded
+	}
+
+	for _, test := range tests {
+		actual, err := decodeTextValue(test.typeOID, test.value)
+		if err != nil {
+			t.Fatalf("decodeTextValue(%d, %q) returned error %s", test.typeOID, test.value, err.Error())
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("decodeTextValue(%d, %q) = %#v, expected %#v", test.typeOID, test.value, actual, test.expected)
+		}
+	}
+
+	if _, err := decodeTextValue(3802, "{"); err == nil {
+		t.Error("decodeTextValue of invalid json should return an error")
+	}
+
+	for _, invalid := range []string{"{1,2", "{1,2}x", "1,2", `{"a}`} {
+		if _, err := decodeTextValue(1007, invalid); err == nil {
+			t.Errorf("decodeTextValue of invalid array %q should return an error", invalid)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package postgres
 
 const (
+	setupEventSchemaQuery = `
+	CREATE SCHEMA IF NOT EXISTS {{schema}}
+	`
+
 	setupFromToEventTableQuery = `
-	CREATE TABLE IF NOT EXISTS "from_to_event" (
+	CREATE {{unlogged}}TABLE IF NOT EXISTS {{event}} (
 		"id" BIGSERIAL PRIMARY KEY,
 		"op" CHAR(1) NOT NULL,
 		"table" VARCHAR(255) NOT NULL,
@@ -10,85 +14,758 @@ const (
 		"ts" BIGINT NOT NULL,
 		"sent" BOOLEAN NOT NULL DEFAULT FALSE
 	);
+
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "before" JSONB;
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "lease_owner" VARCHAR(255);
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "lease_expires_at" TIMESTAMPTZ;
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "schema" VARCHAR(255) NOT NULL DEFAULT 'public';
+	ALTER TABLE {{event}} ALTER COLUMN "row" DROP NOT NULL;
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "txid" BIGINT;
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "tx_seq" BIGINT;
+	ALTER TABLE {{event}} ADD COLUMN IF NOT EXISTS "statement_ts" TIMESTAMPTZ;
+
+	CREATE TABLE IF NOT EXISTS {{delivery}} (
+		"event_id" BIGINT NOT NULL,
+		"channel" VARCHAR(255) NOT NULL,
+		"status" VARCHAR(32) NOT NULL,
+		"attempts" BIGINT NOT NULL DEFAULT 0,
+		"last_error" TEXT,
+		"updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY ("event_id", "channel")
+	);
+	`
+
+	setupPartitionedFromToEventTableQuery = `
+	CREATE TABLE {{event}} (
+		"id" BIGSERIAL,
+		"op" CHAR(1) NOT NULL,
+		"table" VARCHAR(255) NOT NULL,
+		"row" JSONB NOT NULL,
+		"ts" BIGINT NOT NULL,
+		"sent" BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY ("id", "ts")
+	) PARTITION BY RANGE ("ts");
+
+	CREATE {{unlogged}}TABLE {{event_default}} PARTITION OF {{event}} DEFAULT;
+	`
+
+	eventTableExistsQuery = `
+	SELECT to_regclass({{event_literal}}) IS NOT NULL
+	`
+
+	isEventTablePartitionedQuery = `
+	SELECT
+		c.relkind = 'p'
+	FROM
+		pg_class c
+	WHERE
+		c.oid = {{event_literal}}::REGCLASS
+	`
+
+	createEventPartitionPartialQuery = `
+	CREATE {{unlogged}}TABLE IF NOT EXISTS %s PARTITION OF {{event}} FOR VALUES FROM (%d) TO (%d)
+	`
+
+	eventPartitionExistsPartialQuery = `
+	SELECT to_regclass(%s) IS NOT NULL
+	`
+
+	hasDefaultPartitionEventsQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM {{event_default}} WHERE "ts" >= $1 AND "ts" < $2
+	)
+	`
+
+	lockDefaultPartitionQuery = `
+	LOCK TABLE {{event_default}} IN ACCESS EXCLUSIVE MODE
+	`
+
+	createDetachedEventPartitionPartialQuery = `
+	CREATE {{unlogged}}TABLE %s (LIKE {{event}} INCLUDING DEFAULTS INCLUDING CONSTRAINTS)
+	`
+
+	moveDefaultPartitionEventsPartialQuery = `
+	WITH moved AS (
+		DELETE FROM {{event_default}} WHERE "ts" >= $1 AND "ts" < $2 RETURNING *
+	)
+	INSERT INTO %s SELECT * FROM moved
+	`
+
+	attachEventPartitionPartialQuery = `
+	ALTER TABLE {{event}} ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)
+	`
+
+	getEventPartitionsQuery = `
+	SELECT
+		c.relname
+	FROM
+		pg_inherits i
+	JOIN
+		pg_class c ON c.oid = i.inhrelid
+	WHERE
+		i.inhparent = {{event_literal}}::REGCLASS
+		AND c.relname LIKE {{partition_prefix_literal}}
+	ORDER BY
+		c.relname ASC
+	`
+
+	hasUnsentEventsPartialQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM %s WHERE sent = FALSE
+	)
+	`
+
+	archivePartitionPartialQuery = `
+	INSERT INTO {{archive}} (
+		"id",
+		"event"
+	)
+	SELECT
+		p.id,
+		to_jsonb(p.*)
+	FROM
+		%s p
+	`
+
+	deletePartitionDeliveriesPartialQuery = `
+	DELETE FROM
+		{{delivery}}
+	WHERE
+		event_id IN (SELECT id FROM %s)
+	`
+
+	dropPartitionPartialQuery = `
+	DROP TABLE %s
+	`
+
+	setupFromToEventArchiveTableQuery = `
+	CREATE TABLE IF NOT EXISTS {{archive}} (
+		"id" BIGINT NOT NULL,
+		"event" JSONB NOT NULL,
+		"archived_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	`
+
+	getRowsRetentionCutoffQuery = `
+	SELECT
+		fte.id
+	FROM
+		{{event}} fte
+	ORDER BY
+		fte.id DESC
+	OFFSET
+		$1::BIGINT
+	LIMIT
+		1
+	`
+
+	deleteExpiredEventsQuery = `
+	WITH "deleted" AS (
+		DELETE FROM
+			{{event}}
+		WHERE
+			id IN (
+				SELECT
+					fte.id
+				FROM
+					{{event}} fte
+				WHERE
+					fte.sent = TRUE
+					AND (fte.ts < $1 OR fte.id <= $2)
+				ORDER BY
+					fte.id ASC
+				LIMIT
+					$3::BIGINT
+				FOR UPDATE SKIP LOCKED
+			)
+		RETURNING *
+	), "deleted_deliveries" AS (
+		DELETE FROM
+			{{delivery}}
+		WHERE
+			event_id IN (SELECT id FROM "deleted")
+	)
+	SELECT count(*) FROM "deleted"
+	`
+
+	archiveExpiredEventsQuery = `
+	WITH "deleted" AS (
+		DELETE FROM
+			{{event}}
+		WHERE
+			id IN (
+				SELECT
+					fte.id
+				FROM
+					{{event}} fte
+				WHERE
+					fte.sent = TRUE
+					AND (fte.ts < $1 OR fte.id <= $2)
+				ORDER BY
+					fte.id ASC
+				LIMIT
+					$3::BIGINT
+				FOR UPDATE SKIP LOCKED
+			)
+		RETURNING *
+	), "deleted_deliveries" AS (
+		DELETE FROM
+			{{delivery}}
+		WHERE
+			event_id IN (SELECT id FROM "deleted")
+	), "archived" AS (
+		INSERT INTO {{archive}} (
+			"id",
+			"event"
+		)
+		SELECT
+			d.id,
+			to_jsonb(d.*)
+		FROM
+			"deleted" d
+	)
+	SELECT count(*) FROM "deleted"
+	`
+
+	setupFromToFilterRowFunctionQuery = `
+	CREATE OR REPLACE FUNCTION {{filter_row}}(row_data JSONB, columns JSONB)
+	RETURNS JSONB
+	AS $$
+	DECLARE
+		result JSONB := row_data;
+		mask_column TEXT;
+		mask TEXT;
+	BEGIN
+		IF (columns IS NULL OR columns = '{}'::JSONB) THEN
+			RETURN row_data;
+		END IF;
+
+		IF (columns ? 'include') THEN
+			SELECT
+				COALESCE(jsonb_object_agg(r.key, r.value), '{}'::JSONB)
+			INTO
+				result
+			FROM
+				jsonb_each(result) r
+			WHERE
+				r.key IN (SELECT jsonb_array_elements_text(columns->'include'));
+		END IF;
+
+		IF (columns ? 'exclude') THEN
+			result := result - ARRAY(SELECT jsonb_array_elements_text(columns->'exclude'));
+		END IF;
+
+		FOR mask_column, mask IN SELECT m.key, m.value FROM jsonb_each_text(COALESCE(columns->'mask', '{}'::JSONB)) m LOOP
+			IF (result ? mask_column AND jsonb_typeof(result->mask_column) <> 'null') THEN
+				result := jsonb_set(result, ARRAY[mask_column], CASE mask
+					WHEN 'hash' THEN to_jsonb(encode(sha256(convert_to(result->>mask_column, 'UTF8')), 'hex'))
+					WHEN 'truncate' THEN to_jsonb(left(result->>mask_column, (columns->>'truncateLength')::INT))
+					ELSE to_jsonb('[redacted]'::TEXT)
+				END);
+			END IF;
+		END LOOP;
+
+		RETURN result;
+	END
+	$$ LANGUAGE PLPGSQL IMMUTABLE;
 	`
 
 	setupFromToProcessEventFunctionQuery = `
-	CREATE OR REPLACE FUNCTION "from_to_process_event"()
+	CREATE OR REPLACE FUNCTION {{function}}()
 	RETURNS TRIGGER
 	AS $$
+	DECLARE
+		columns JSONB := CASE WHEN TG_NARGS > 0 THEN TG_ARGV[0]::JSONB END;
+		tx_seq BIGINT := COALESCE(NULLIF(current_setting({{tx_seq_setting_literal}}, TRUE), ''), '0')::BIGINT + 1;
+		tx_tables JSONB;
+		qualified_table TEXT := TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME;
 	BEGIN
+		PERFORM set_config({{tx_seq_setting_literal}}, tx_seq::TEXT, TRUE);
+
+		IF ({{transaction_markers}}) THEN
+			tx_tables := COALESCE(NULLIF(current_setting({{tx_tables_setting_literal}}, TRUE), ''), '{}')::JSONB;
+			tx_tables := jsonb_set(
+				tx_tables,
+				ARRAY[qualified_table],
+				to_jsonb(COALESCE((tx_tables->>qualified_table)::BIGINT, 0) + 1));
+
+			PERFORM set_config({{tx_tables_setting_literal}}, tx_tables::TEXT, TRUE);
+		END IF;
+
 		IF (TG_OP = 'DELETE') THEN
-			INSERT INTO "from_to_event" (
+			INSERT INTO {{event}} (
 				"op",
+				"schema",
 				"table",
 				"row",
-				"ts"
+				"ts",
+				"txid",
+				"tx_seq",
+				"statement_ts"
 			)
 			SELECT
 				'D',
+				TG_TABLE_SCHEMA,
 				TG_TABLE_NAME,
-				row_to_json(OLD.*),
-				(extract(epoch from now()));
+				{{filter_row}}(to_jsonb(OLD.*), columns),
+				(extract(epoch from now())),
+				txid_current(),
+				tx_seq,
+				statement_timestamp();
 		ELSIF (TG_OP = 'UPDATE') THEN
-			INSERT INTO "from_to_event" (
+			INSERT INTO {{event}} (
 				"op",
+				"schema",
 				"table",
 				"row",
-				"ts"
+				"before",
+				"ts",
+				"txid",
+				"tx_seq",
+				"statement_ts"
 			)
 			SELECT
 				'U',
+				TG_TABLE_SCHEMA,
 				TG_TABLE_NAME,
-				row_to_json(NEW.*),
-				(extract(epoch from now()));
+				{{filter_row}}(to_jsonb(NEW.*), columns),
+				{{filter_row}}(to_jsonb(OLD.*), columns),
+				(extract(epoch from now())),
+				txid_current(),
+				tx_seq,
+				statement_timestamp();
 		ELSIF (TG_OP = 'INSERT') THEN
-			INSERT INTO "from_to_event" (
+			INSERT INTO {{event}} (
 				"op",
+				"schema",
 				"table",
 				"row",
-				"ts"
+				"ts",
+				"txid",
+				"tx_seq",
+				"statement_ts"
 			)
 			SELECT
 				'I',
+				TG_TABLE_SCHEMA,
 				TG_TABLE_NAME,
-				row_to_json(NEW.*),
-				(extract(epoch from now()));
+				{{filter_row}}(to_jsonb(NEW.*), columns),
+				(extract(epoch from now())),
+				txid_current(),
+				tx_seq,
+				statement_timestamp();
+		ELSIF (TG_OP = 'TRUNCATE') THEN
+			INSERT INTO {{event}} (
+				"op",
+				"schema",
+				"table",
+				"ts",
+				"txid",
+				"tx_seq",
+				"statement_ts"
+			)
+			SELECT
+				'T',
+				TG_TABLE_SCHEMA,
+				TG_TABLE_NAME,
+				(extract(epoch from now())),
+				txid_current(),
+				tx_seq,
+				statement_timestamp();
 		END IF;
+		PERFORM pg_notify({{notification_channel_literal}}, '');
 		RETURN NULL;
 	END
 	$$ LANGUAGE PLPGSQL;
 	`
 
+	setupFromToProcessCommitFunctionQuery = `
+	CREATE OR REPLACE FUNCTION {{commit_function}}()
+	RETURNS TRIGGER
+	AS $$
+	DECLARE
+		tx_tables TEXT := NULLIF(current_setting({{tx_tables_setting_literal}}, TRUE), '');
+	BEGIN
+		IF (tx_tables IS NULL) THEN
+			RETURN NULL;
+		END IF;
+
+		PERFORM set_config({{tx_tables_setting_literal}}, '', TRUE);
+
+		INSERT INTO {{event}} (
+			"op",
+			"schema",
+			"table",
+			"row",
+			"ts",
+			"txid",
+			"tx_seq",
+			"statement_ts"
+		)
+		SELECT
+			'C',
+			'',
+			'',
+			jsonb_build_object('tables', tx_tables::JSONB),
+			(extract(epoch from now())),
+			txid_current(),
+			COALESCE(NULLIF(current_setting({{tx_seq_setting_literal}}, TRUE), ''), '0')::BIGINT + 1,
+			clock_timestamp();
+
+		RETURN NULL;
+	END
+	$$ LANGUAGE PLPGSQL;
+	`
+
+	// Deferred until the commit, so it fires after every event of the
+	// transaction was written
+	setupCommitTriggerQuery = `
+	DROP TRIGGER IF EXISTS {{commit_trigger}} ON {{event}};
+
+	CREATE CONSTRAINT TRIGGER {{commit_trigger}}
+	AFTER INSERT ON {{event}}
+	DEFERRABLE INITIALLY DEFERRED
+	FOR EACH ROW EXECUTE FUNCTION {{commit_function}}();
+	`
+
+	dropCommitTriggerQuery = `
+	DROP TRIGGER IF EXISTS {{commit_trigger}} ON {{event}}
+	`
+
 	setupTableTriggerPartialQuery = `
 	CREATE OR REPLACE TRIGGER %s
-	AFTER INSERT OR UPDATE OR DELETE ON %s
-	FOR EACH ROW EXECUTE FUNCTION from_to_process_event()
+	AFTER %s ON %s
+	FOR EACH %s %s EXECUTE FUNCTION {{function}}(%s)
 	`
 
 	getEventsToSendQuery = `
 	SELECT
 		fte.id,
 		fte.op,
+		fte.schema,
 		fte.table,
 		fte.row,
+		fte.before,
 		fte.ts,
+		fte.statement_ts,
+		fte.txid,
+		fte.tx_seq,
 		fte.sent
 	FROM
-		from_to_event fte
+		{{event}} fte
 	WHERE
 		fte.sent = FALSE
 	ORDER BY
-		fte.ts ASC
+		fte.id ASC
 	LIMIT
 		$1::BIGINT
 	`
 
-	setEventAsSentQuery = `
+	leaseEventsToSendQuery = `
+	UPDATE
+		{{event}} fte
+	SET
+		lease_owner = $2,
+		lease_expires_at = now() + make_interval(secs => $3)
+	WHERE
+		fte.id IN (
+			SELECT
+				ftel.id
+			FROM
+				{{event}} ftel
+			WHERE
+				ftel.sent = FALSE
+				AND (
+					ftel.lease_expires_at IS NULL
+					OR ftel.lease_expires_at < now()
+					OR ftel.lease_owner = $2
+				)
+			ORDER BY
+				ftel.id ASC
+			LIMIT
+				$1::BIGINT
+			FOR UPDATE SKIP LOCKED
+		)
+	RETURNING
+		fte.id,
+		fte.op,
+		fte.schema,
+		fte.table,
+		fte.row,
+		fte.before,
+		fte.ts,
+		fte.statement_ts,
+		fte.txid,
+		fte.tx_seq,
+		fte.sent
+	`
+
+	setupFromToSnapshotTableQuery = `
+	CREATE TABLE IF NOT EXISTS {{snapshot}} (
+		"table" VARCHAR(255) PRIMARY KEY,
+		"last_key" JSONB,
+		"rows" BIGINT NOT NULL DEFAULT 0,
+		"started_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+		"completed_at" TIMESTAMPTZ
+	);
+	`
+
+	startSnapshotQuery = `
+	INSERT INTO {{snapshot}} (
+		"table"
+	) VALUES (
+		$1
+	)
+	ON CONFLICT ("table") DO NOTHING
+	`
+
+	restartSnapshotQuery = `
+	INSERT INTO {{snapshot}} (
+		"table"
+	) VALUES (
+		$1
+	)
+	ON CONFLICT ("table") DO UPDATE SET
+		last_key = NULL,
+		rows = 0,
+		started_at = now(),
+		completed_at = NULL
+	`
+
+	lockSnapshotProgressQuery = `
+	SELECT
+		fts.last_key,
+		fts.completed_at IS NOT NULL
+	FROM
+		{{snapshot}} fts
+	WHERE
+		fts.table = $1
+	FOR UPDATE
+	`
+
+	updateSnapshotProgressQuery = `
+	UPDATE
+		{{snapshot}}
+	SET
+		last_key = $2,
+		rows = rows + $3,
+		completed_at = CASE WHEN $4::BOOLEAN THEN now() ELSE NULL END
+	WHERE
+		"table" = $1
+	`
+
+	getPrimaryKeyColumnsQuery = `
+	SELECT
+		a.attname
+	FROM
+		pg_index i
+	JOIN
+		pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+	WHERE
+		i.indrelid = $1::REGCLASS
+		AND i.indisprimary
+	ORDER BY
+		array_position(i.indkey::SMALLINT[], a.attnum)
+	`
+
+	getSnapshotChunkPartialQuery = `
+	SELECT
+		%s,
+		row_to_json(new.*)
+	FROM
+		%s new
+	%s
+	ORDER BY
+		%s
+	LIMIT
+		%d
+	`
+
+	insertSnapshotEventsQuery = `
+	INSERT INTO {{event}} (
+		"op",
+		"schema",
+		"table",
+		"row",
+		"ts",
+		"txid",
+		"tx_seq",
+		"statement_ts"
+	)
+	SELECT
+		'R',
+		n.nspname,
+		c.relname,
+		{{filter_row}}(r.value, $3::JSONB),
+		(extract(epoch from now())),
+		txid_current(),
+		r.ordinality,
+		statement_timestamp()
+	FROM
+		pg_class c
+	JOIN
+		pg_namespace n ON n.oid = c.relnamespace
+	CROSS JOIN
+		jsonb_array_elements($2::JSONB) WITH ORDINALITY r
+	WHERE
+		c.oid = $1::REGCLASS
+	ORDER BY
+		r.ordinality
+	`
+
+	tryAdvisoryLockQuery = `
+	SELECT pg_try_advisory_lock($1)
+	`
+
+	advisoryUnlockQuery = `
+	SELECT pg_advisory_unlock($1)
+	`
+
+	tryRetentionLockQuery = `
+	SELECT pg_try_advisory_lock($1, $2)
+	`
+
+	retentionUnlockQuery = `
+	SELECT pg_advisory_unlock($1, $2)
+	`
+
+	getDeliveredChannelsQuery = `
+	SELECT
+		fted.event_id,
+		fted.channel
+	FROM
+		{{delivery}} fted
+	WHERE
+		fted.event_id = ANY($1::BIGINT[])
+		AND fted.status = 'delivered'
+	`
+
+	saveDeliveryQuery = `
+	INSERT INTO {{delivery}} AS fted (
+		event_id,
+		channel,
+		status,
+		attempts,
+		last_error,
+		updated_at
+	) VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		now()
+	)
+	ON CONFLICT (event_id, channel) DO UPDATE SET
+		status = EXCLUDED.status,
+		attempts = fted.attempts + EXCLUDED.attempts,
+		last_error = EXCLUDED.last_error,
+		updated_at = EXCLUDED.updated_at
+	`
+
+	setEventsAsSentQuery = `
 	UPDATE
-		from_to_event
+		{{event}}
 	SET
 		sent = TRUE
 	WHERE
-		id = $1
+		id = ANY($1)
+	`
+
+	publicationExistsQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM pg_publication WHERE pubname = $1
+	)
+	`
+
+	createPublicationPartialQuery = `
+	CREATE PUBLICATION %s FOR TABLE %s
+	`
+
+	alterPublicationPartialQuery = `
+	ALTER PUBLICATION %s SET TABLE %s
+	`
+
+	getReplicationSlotQuery = `
+	SELECT
+		confirmed_flush_lsn::TEXT
+	FROM
+		pg_replication_slots
+	WHERE
+		slot_name = $1
+		AND plugin = 'pgoutput'
 	`
+
+	createReplicationSlotQuery = `
+	SELECT
+		lsn::TEXT
+	FROM
+		pg_create_logical_replication_slot($1, 'pgoutput')
+	`
+
+	startReplicationPartialQuery = `
+	START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names %s)
+	`
+
+	setupFromToDeadLetterTableQuery = `
+	CREATE TABLE IF NOT EXISTS {{dead_letter}} (
+		"id" BIGSERIAL PRIMARY KEY,
+		"event_id" BIGINT NOT NULL,
+		"channel" VARCHAR(255) NOT NULL,
+		"event" JSONB NOT NULL,
+		"payload" TEXT,
+		"error" TEXT NOT NULL,
+		"attempts" BIGINT NOT NULL,
+		"created_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	`
+
+	insertDeadLetterQuery = `
+	INSERT INTO {{dead_letter}} (
+		event_id,
+		channel,
+		event,
+		payload,
+		error,
+		attempts
+	) VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6
+	)
+	`
+
+	getInstalledTriggersQuery = `
+	SELECT
+		c.oid,
+		n.nspname,
+		c.relname,
+		t.tgname
+	FROM
+		pg_trigger t
+	JOIN
+		pg_class c ON c.oid = t.tgrelid
+	JOIN
+		pg_namespace n ON n.oid = c.relnamespace
+	WHERE
+		NOT t.tgisinternal
+		AND t.tgfoid = to_regprocedure({{function_literal}})
+	ORDER BY
+		n.nspname,
+		c.relname,
+		t.tgname
+	`
+
+	getTableOIDQuery = `
+	SELECT to_regclass($1)::OID
+	`
+
+	dropTriggerPartialQuery = `DROP TRIGGER IF EXISTS %s ON %s`
+
+	dropFunctionsQuery = `DROP FUNCTION IF EXISTS {{function}}(), {{commit_function}}(), {{filter_row}}(JSONB, JSONB) CASCADE`
+
+	dropTablesQuery = `DROP TABLE IF EXISTS {{event}}, {{delivery}}, {{archive}}, {{snapshot}}, {{dead_letter}}`
 )
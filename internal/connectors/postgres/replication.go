@@ -0,0 +1,527 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/connectors/eventtable"
+	"github.com/gustapinto/from-to/internal/event"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/lib/pq"
+)
+
+type ReplicationListener struct {
+	dsn                    string
+	slotName               string
+	publicationName        string
+	statusInterval         time.Duration
+	retrier                event.Retrier
+	timeout                time.Duration
+	db                     *sql.DB
+	conn                   *pgconn.PgConn
+	logger                 *slog.Logger
+	tableToChannelRelation map[string][]event.Channel
+	tables                 map[string]Table
+	relations              map[uint32]relation
+	currentBegin           beginMessage
+	flushedLSN             lsn
+	names                  objectNames
+	transactionMarkers     bool
+	txSeq                  uint64
+	txTableEvents          map[string]uint64
+}
+
+func NewReplicationListener(config Config, channels map[string]event.Channel) (*ReplicationListener, error) {
+	listener := &ReplicationListener{
+		dsn:             config.DSN,
+		slotName:        config.Replication.SlotNameOrDefault(config.NamePrefixOrDefault()),
+		publicationName: config.Replication.PublicationNameOrDefault(config.NamePrefixOrDefault()),
+		names:           newObjectNames(config),
+		statusInterval:  config.Replication.StatusIntervalSecondsOrDefault(),
+		timeout:         config.TimeoutSecondsOrDefault(),
+		logger:          slog.With("listener", "PostgresReplication"),
+		relations:       make(map[uint32]relation),
+		tables:          make(map[string]Table, len(config.Tables)),
+
+		transactionMarkers: event.UsesTransactionMarkers(channels),
+		txTableEvents:      make(map[string]uint64),
+	}
+
+	// Keeps the replication connection alive while waiting to retry
+	listener.retrier = event.Retrier{
+		Interval:   config.PollSecondsOrDefault(),
+		Logger:     listener.logger,
+		BeforeWait: listener.sendStandbyStatusUpdate,
+	}
+
+	for _, table := range config.Tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+
+		// Changes are read from the WAL, so there is no trigger to keep the
+		// filtered columns from leaving the database
+		if table.Columns.Enabled() {
+			return nil, fmt.Errorf("can not filter the columns of table [%s], only supported by the postgres connector", table.Name)
+		}
+
+		if table.When != "" || table.SkipUnchangedUpdates {
+			return nil, fmt.Errorf("can not filter the rows of table [%s], only supported by the postgres connector", table.Name)
+		}
+
+		listener.tables[table.Name] = table
+
+		if table.Snapshot {
+			listener.logger.Warn("Snapshots are only supported by the postgres input, ignoring", "table", table.Name)
+		}
+	}
+
+	if err := listener.connectToDatabase(config.DSN); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupPublication(config.Tables); err != nil {
+		return nil, err
+	}
+
+	if err := setupPrimaryKeys(listener.db, listener.timeout, listener.tables, listener.logger); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupReplicationSlot(); err != nil {
+		return nil, err
+	}
+
+	if event.UsesDeadLetterTable(channels) {
+		if err := setupDeadLetterTable(listener.db, listener.names, listener.timeout); err != nil {
+			return nil, err
+		}
+
+		listener.logger.Debug("Dead letter table setup complete")
+	}
+
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
+	listener.logger.Info("Connector setup completed")
+
+	return listener, nil
+}
+
+// Streams changes until ctx is done. A change that was already received is
+// always published before stopping
+func (l *ReplicationListener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	if err := l.startReplication(ctx); err != nil {
+		return err
+	}
+
+	l.logger.Info("Streaming changes from replication slot", "slot", l.slotName, "lsn", l.flushedLSN)
+
+	nextStatusDeadline := time.Now().Add(l.statusInterval)
+	for {
+		if time.Now().After(nextStatusDeadline) {
+			if err := l.sendStandbyStatusUpdate(ctx); err != nil {
+				return err
+			}
+
+			nextStatusDeadline = time.Now().Add(l.statusInterval)
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, nextStatusDeadline)
+		message, err := l.conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				l.logger.Info("Listener stopped")
+				return nil
+			}
+
+			if pgconn.Timeout(err) {
+				continue
+			}
+
+			return err
+		}
+
+		switch message := message.(type) {
+		case *pgproto3.CopyData:
+			if err := l.handleCopyData(ctx, message.Data, callback); err != nil {
+				if ctx.Err() != nil {
+					l.logger.Info("Listener stopped")
+					return nil
+				}
+
+				return err
+			}
+
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(message)
+		}
+	}
+}
+
+// Reports the last acknowledged position before closing the connections, so
+// the slot does not replay changes that were already published
+func (l *ReplicationListener) Close() error {
+	var errs []error
+	if l.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+		defer cancel()
+
+		errs = append(errs, l.sendStandbyStatusUpdate(ctx), l.conn.Close(ctx))
+	}
+
+	errs = append(errs, l.db.Close())
+
+	return errors.Join(errs...)
+}
+
+func (l *ReplicationListener) WriteDeadLetter(ctx context.Context, deadLetter event.DeadLetter) error {
+	return eventtable.WriteDeadLetter(ctx, l.db, l.names.render(insertDeadLetterQuery), l.timeout, deadLetter)
+}
+
+func (l *ReplicationListener) connectToDatabase(dsn string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	l.db = db
+
+	l.logger.Debug("Connected to database", "dsn", dsn)
+	return nil
+}
+
+func (l *ReplicationListener) setupPublication(tables []Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var exists bool
+	if err := l.db.QueryRowContext(ctx, publicationExistsQuery, l.publicationName).Scan(&exists); err != nil {
+		return err
+	}
+
+	query := createPublicationPartialQuery
+	if exists {
+		query = alterPublicationPartialQuery
+	}
+
+	quotedTables := make([]string, 0, len(tables))
+	for _, table := range tables {
+		quotedTables = append(quotedTables, table.QuotedName())
+	}
+
+	query = fmt.Sprintf(query, pq.QuoteIdentifier(l.publicationName), strings.Join(quotedTables, ", "))
+	if _, err := l.db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	l.logger.Debug("Publication setup complete", "publication", l.publicationName, "tables", quotedTables)
+
+	return nil
+}
+
+func (l *ReplicationListener) setupReplicationSlot() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var confirmedFlushLSN sql.NullString
+	err := l.db.QueryRowContext(ctx, getReplicationSlotQuery, l.slotName).Scan(&confirmedFlushLSN)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		err = l.db.QueryRowContext(ctx, createReplicationSlotQuery, l.slotName).Scan(&confirmedFlushLSN)
+		if err != nil {
+			return err
+		}
+
+		l.logger.Debug("Replication slot created", "slot", l.slotName)
+	} else {
+		l.logger.Debug("Reusing existing replication slot", "slot", l.slotName)
+	}
+
+	flushedLSN, err := parseLSN(confirmedFlushLSN.String)
+	if err != nil {
+		return err
+	}
+
+	l.flushedLSN = flushedLSN
+
+	return nil
+}
+
+func (l *ReplicationListener) startReplication(ctx context.Context) error {
+	connConfig, err := pgconn.ParseConfig(l.dsn)
+	if err != nil {
+		return err
+	}
+
+	connConfig.RuntimeParams["replication"] = "database"
+
+	connectCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	conn, err := pgconn.ConnectConfig(connectCtx, connConfig)
+	if err != nil {
+		return err
+	}
+
+	l.conn = conn
+
+	query := fmt.Sprintf(
+		startReplicationPartialQuery,
+		pq.QuoteIdentifier(l.slotName),
+		l.flushedLSN,
+		pq.QuoteLiteral(l.publicationName))
+
+	l.conn.Frontend().Send(&pgproto3.Query{String: query})
+	if err := l.conn.Frontend().Flush(); err != nil {
+		return err
+	}
+
+	for {
+		message, err := l.conn.ReceiveMessage(connectCtx)
+		if err != nil {
+			return err
+		}
+
+		switch message := message.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(message)
+
+		default:
+			return fmt.Errorf("unexpected message %T while starting replication", message)
+		}
+	}
+}
+
+func (l *ReplicationListener) sendStandbyStatusUpdate(ctx context.Context) error {
+	data := encodeStandbyStatusUpdate(l.flushedLSN, time.Now())
+
+	l.conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	if err := l.conn.Frontend().Flush(); err != nil {
+		return err
+	}
+
+	l.logger.Debug("Sent standby status update", "lsn", l.flushedLSN)
+
+	return nil
+}
+
+func (l *ReplicationListener) handleCopyData(
+	ctx context.Context,
+	data []byte,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] {
+	case _primaryKeepaliveMessageByteID:
+		keepalive, err := parsePrimaryKeepalive(data[1:])
+		if err != nil {
+			return err
+		}
+
+		if keepalive.replyRequested {
+			return l.sendStandbyStatusUpdate(ctx)
+		}
+
+	case _xLogDataByteID:
+		xld, err := parseXLogData(data[1:])
+		if err != nil {
+			return err
+		}
+
+		return l.handleLogicalMessage(ctx, xld, callback)
+	}
+
+	return nil
+}
+
+func (l *ReplicationListener) handleLogicalMessage(
+	ctx context.Context,
+	xld xLogData,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	if len(xld.data) == 0 {
+		return nil
+	}
+
+	switch xld.data[0] {
+	case _pgoutputRelation:
+		rel, err := parseRelation(xld.data)
+		if err != nil {
+			return err
+		}
+
+		l.relations[rel.id] = rel
+
+	case _pgoutputBegin:
+		begin, err := parseBegin(xld.data)
+		if err != nil {
+			return err
+		}
+
+		l.currentBegin = begin
+		l.txSeq = 0
+		clear(l.txTableEvents)
+
+	case _pgoutputInsert, _pgoutputUpdate, _pgoutputDelete:
+		message, err := parseRowMessage(xld.data)
+		if err != nil {
+			return err
+		}
+
+		e, err := l.rowMessageToEvent(xld.walStart, message)
+		if err != nil {
+			return err
+		}
+
+		return l.publishEventIfCaptured(ctx, e, callback)
+
+	case _pgoutputTruncate:
+		message, err := parseTruncate(xld.data)
+		if err != nil {
+			return err
+		}
+
+		// A single truncate may cover many tables, each one gets its own event.
+		// The WAL record holds 4 bytes for every relation, so offsetting the LSN
+		// by the relation index never reaches the LSN of the next change
+		for i, relationID := range message.relationIDs {
+			rel, exists := l.relations[relationID]
+			if !exists {
+				return fmt.Errorf("received truncate for unknown relation %d", relationID)
+			}
+
+			e := l.newEvent(xld.walStart+lsn(i), event.OpTruncate)
+			e.Schema = rel.namespace
+			e.Table = rel.name
+
+			if err := l.publishEventIfCaptured(ctx, e, callback); err != nil {
+				return err
+			}
+		}
+
+	case _pgoutputCommit:
+		commit, err := parseCommit(xld.data)
+		if err != nil {
+			return err
+		}
+
+		if l.transactionMarkers && len(l.txTableEvents) > 0 {
+			l.txSeq++
+
+			marker := l.newEvent(commit.commitLSN, event.OpCommit)
+			marker.Row = event.NewTransactionMarker(l.txTableEvents)
+
+			if err := l.publishEvent(ctx, marker, callback); err != nil {
+				return err
+			}
+		}
+
+		// Only acknowledge the transaction after every change on it was
+		// published, so a restart replays anything that was not processed
+		l.flushedLSN = commit.endLSN
+
+		return l.sendStandbyStatusUpdate(ctx)
+	}
+
+	return nil
+}
+
+func (l *ReplicationListener) rowMessageToEvent(walStart lsn, message rowMessage) (e event.Event, err error) {
+	rel, exists := l.relations[message.relationID]
+	if !exists {
+		return e, fmt.Errorf("received change for unknown relation %d", message.relationID)
+	}
+
+	e = l.newEvent(walStart, string(message.op))
+	e.Schema = rel.namespace
+	e.Table = rel.name
+
+	tuple := message.newTuple
+	if message.op == _pgoutputDelete {
+		tuple = message.oldTuple
+	}
+
+	if message.op == _pgoutputUpdate && message.oldTuple != nil {
+		e.Before, _, err = rel.tupleToRow(message.oldTuple, nil)
+		if err != nil {
+			return e, err
+		}
+	}
+
+	e.Row, e.Unchanged, err = rel.tupleToRow(tuple, e.Before)
+	if err != nil {
+		return e, err
+	}
+
+	table := tableForEvent(l.tables, e)
+	e.Key = event.KeyFromRow(table.primaryKey, e.Row)
+
+	// A key only old tuple does not carry the other columns, so it can not be
+	// used to tell which of them changed
+	if e.Before != nil && message.oldTupleKind == _tupleOld && table.ChangedColumns {
+		e.Changed = event.ChangedColumns(e.Before, e.Row)
+	}
+
+	return e, nil
+}
+
+func (l *ReplicationListener) publishEventIfCaptured(
+	ctx context.Context,
+	e event.Event,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	table := tableForEvent(l.tables, e)
+	if !slices.Contains(table.OperationsOrDefault(), e.Op) {
+		l.logger.Debug("Operation is not captured for table, skipping", "event", e)
+		return nil
+	}
+
+	// Like the trigger, only captured changes are counted on the transaction
+	l.txSeq++
+	l.txTableEvents[e.Schema+"."+e.Table]++
+	e.TxSeq = l.txSeq
+
+	return l.publishEvent(ctx, e, callback)
+}
+
+// Returns an event of the current transaction, there is no statement
+// timestamp on the WAL so the commit timestamp is used instead
+func (l *ReplicationListener) newEvent(walStart lsn, op string) event.Event {
+	return event.Event{
+		ID:        uint64(walStart),
+		Ts:        uint64(l.currentBegin.commitTime.Unix()),
+		Timestamp: l.currentBegin.commitTime,
+		TxID:      uint64(l.currentBegin.xid),
+		TxSeq:     l.txSeq,
+		Op:        op,
+	}
+}
+
+// The slot is not advanced while the event is retried, so the change is
+// replayed if the application stops before every channel acknowledged it
+func (l *ReplicationListener) publishEvent(
+	ctx context.Context,
+	e event.Event,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	return l.retrier.Publish(ctx, e, l.tableToChannelRelation, callback)
+}
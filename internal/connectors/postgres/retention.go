@@ -0,0 +1,387 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const _eventPartitionDateFormat = "20060102"
+
+func (l *Listener) setupRetention(ctx context.Context, tx *sql.Tx) error {
+	if l.retention.Partitioned {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, l.names.render(eventTableExistsQuery)).Scan(&exists); err != nil {
+			return err
+		}
+
+		if !exists {
+			if _, err := tx.ExecContext(ctx, l.names.render(setupPartitionedFromToEventTableQuery)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.retention.Archive {
+		if _, err := tx.ExecContext(ctx, l.names.render(setupFromToEventArchiveTableQuery)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks if the event table is actually partitioned, since an event table
+// created before enabling partitioning is kept as is
+func (l *Listener) setupPartitions(ctx context.Context, tx *sql.Tx) error {
+	if !l.retention.Partitioned {
+		return nil
+	}
+
+	var isPartitioned bool
+	if err := tx.QueryRowContext(ctx, l.names.render(isEventTablePartitionedQuery)).Scan(&isPartitioned); err != nil {
+		return err
+	}
+
+	if !isPartitioned {
+		l.logger.Warn("Event table already exists and is not partitioned, pruning it with DELETE instead")
+		l.retention.Partitioned = false
+	}
+
+	return nil
+}
+
+// Partitions are created out of the setup transaction, so failing to create
+// them does not prevent the listener from starting. Events keep landing on the
+// default partition until the retention policy creates them
+func (l *Listener) setupUpcomingPartitions() {
+	if !l.retention.Partitioned {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	err := l.withRetentionLock(ctx, func() error {
+		return l.transaction(ctx, func(tx *sql.Tx) error {
+			return l.createUpcomingPartitions(ctx, tx)
+		})
+	})
+	if err != nil {
+		l.logger.Warn("Failed to create event partitions, retrying with the retention policy", "error", err.Error())
+	}
+}
+
+// Runs the retention policy every interval until ctx is done
+func (l *Listener) runRetention(ctx context.Context) {
+	if !l.retention.Enabled() && !l.retention.Partitioned {
+		return
+	}
+
+	ticker := time.NewTicker(l.retention.IntervalSecondsOrDefault())
+	defer ticker.Stop()
+
+	for {
+		err := l.withRetentionLock(ctx, func() error {
+			return l.applyRetention(ctx)
+		})
+		if err != nil && ctx.Err() == nil {
+			l.logger.Error("Failed to apply retention policy", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs callback only if no other instance is applying the retention policy on
+// the same event table, whatever the coordination mode. The lock uses the two
+// key form of advisory locks, which does not overlap the leader lock
+func (l *Listener) withRetentionLock(ctx context.Context, callback func() error) error {
+	lockCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	conn, err := l.db.Conn(lockCtx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	classID, objectID := int32(l.lockID>>32), int32(l.lockID)
+
+	var acquired bool
+	if err := conn.QueryRowContext(lockCtx, tryRetentionLockQuery, classID, objectID).Scan(&acquired); err != nil {
+		return err
+	}
+
+	if !acquired {
+		l.logger.Debug("Another instance is applying the retention policy, skipping")
+		return nil
+	}
+
+	err = callback()
+
+	// Unlocked explicitly, as the session goes back to the pool
+	unlockCtx, unlockCancel := context.WithTimeout(context.WithoutCancel(ctx), l.timeout)
+	defer unlockCancel()
+
+	if _, unlockErr := conn.ExecContext(unlockCtx, retentionUnlockQuery, classID, objectID); unlockErr != nil {
+		return errors.Join(err, unlockErr)
+	}
+
+	return err
+}
+
+func (l *Listener) applyRetention(ctx context.Context) error {
+	if l.retention.Partitioned {
+		if err := l.transaction(ctx, func(tx *sql.Tx) error {
+			return l.createUpcomingPartitions(ctx, tx)
+		}); err != nil {
+			return err
+		}
+
+		if err := l.dropExpiredPartitions(ctx); err != nil {
+			return err
+		}
+	}
+
+	if !l.retention.Enabled() {
+		return nil
+	}
+
+	return l.deleteExpiredEvents(ctx)
+}
+
+func (l *Listener) deleteExpiredEvents(ctx context.Context) error {
+	ageCutoff := int64(0)
+	if l.retention.MaxAgeHours > 0 {
+		ageCutoff = time.Now().Add(-l.retention.MaxAgeOrDefault()).Unix()
+	}
+
+	idCutoff, err := l.getRowsRetentionCutoff(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := l.names.render(deleteExpiredEventsQuery)
+	if l.retention.Archive {
+		query = l.names.render(archiveExpiredEventsQuery)
+	}
+
+	batchSize := l.retention.BatchSizeOrDefault()
+	total := uint64(0)
+	for ctx.Err() == nil {
+		queryCtx, cancel := context.WithTimeout(ctx, l.timeout)
+
+		var deleted uint64
+		err := l.db.QueryRowContext(queryCtx, query, ageCutoff, idCutoff, batchSize).Scan(&deleted)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		total += deleted
+		if deleted < batchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		l.logger.Info("Pruned sent events", "events", total, "archived", l.retention.Archive)
+	}
+
+	return nil
+}
+
+// Returns the id of the newest event beyond the max rows, or zero if the
+// table does not hold more than max rows
+func (l *Listener) getRowsRetentionCutoff(ctx context.Context) (int64, error) {
+	if l.retention.MaxRows == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	var idCutoff int64
+	err := l.db.QueryRowContext(ctx, l.names.render(getRowsRetentionCutoffQuery), l.retention.MaxRows).Scan(&idCutoff)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return idCutoff, err
+}
+
+// Creates the daily partitions for today and tomorrow, so new events do not
+// land on the default partition
+func (l *Listener) createUpcomingPartitions(ctx context.Context, tx *sql.Tx) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	for _, day := range []time.Time{today, today.AddDate(0, 0, 1)} {
+		name := l.names.partitionPrefix() + day.Format(_eventPartitionDateFormat)
+		if err := l.createPartition(ctx, tx, name, day.Unix(), day.AddDate(0, 0, 1).Unix()); err != nil {
+			return fmt.Errorf("failed to create partition [%s], got error %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Postgres refuses to create a partition while the default partition holds
+// rows of its range, which happens when the application was down as the day
+// changed. Those rows are moved to the new table before attaching it
+func (l *Listener) createPartition(ctx context.Context, tx *sql.Tx, name string, from, to int64) error {
+	quotedName := l.names.qualify(name)
+
+	var exists bool
+	query := fmt.Sprintf(eventPartitionExistsPartialQuery, pq.QuoteLiteral(quotedName))
+	if err := tx.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	var hasDefaultEvents bool
+	if err := tx.QueryRowContext(ctx, l.names.render(hasDefaultPartitionEventsQuery), from, to).Scan(&hasDefaultEvents); err != nil {
+		return err
+	}
+
+	if !hasDefaultEvents {
+		query := fmt.Sprintf(l.names.render(createEventPartitionPartialQuery), quotedName, from, to)
+		_, err := tx.ExecContext(ctx, query)
+
+		return err
+	}
+
+	// Writers are blocked until the transaction ends, so no event of the range
+	// lands on the default partition after its rows were moved
+	if _, err := tx.ExecContext(ctx, l.names.render(lockDefaultPartitionQuery)); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(l.names.render(createDetachedEventPartitionPartialQuery), quotedName)); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(l.names.render(moveDefaultPartitionEventsPartialQuery), quotedName), from, to)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(l.names.render(attachEventPartitionPartialQuery), quotedName, from, to)
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	moved, _ := result.RowsAffected()
+	l.logger.Info("Moved events out of the default partition", "partition", name, "events", moved)
+
+	return nil
+}
+
+// Drops the daily partitions that are entirely older than the max age and
+// whose events were all sent, which is much cheaper than deleting their rows
+func (l *Listener) dropExpiredPartitions(ctx context.Context) error {
+	if l.retention.MaxAgeHours == 0 {
+		return nil
+	}
+
+	partitions, err := l.getEventPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	ageCutoff := time.Now().Add(-l.retention.MaxAgeOrDefault())
+	for _, partition := range partitions {
+		day, err := time.Parse(_eventPartitionDateFormat, strings.TrimPrefix(partition, l.names.partitionPrefix()))
+		if err != nil {
+			continue
+		}
+
+		if day.AddDate(0, 0, 1).After(ageCutoff) {
+			break
+		}
+
+		dropped, err := l.dropPartitionIfSent(ctx, partition)
+		if err != nil {
+			return err
+		}
+
+		if dropped {
+			l.logger.Info("Dropped expired event partition", "partition", partition, "archived", l.retention.Archive)
+		}
+	}
+
+	return nil
+}
+
+func (l *Listener) getEventPartitions(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	rows, err := l.db.QueryContext(ctx, l.names.render(getEventPartitionsQuery))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			return nil, err
+		}
+
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, rows.Err()
+}
+
+func (l *Listener) dropPartitionIfSent(ctx context.Context, partition string) (dropped bool, err error) {
+	quotedPartition := l.names.qualify(partition)
+
+	err = l.transaction(ctx, func(tx *sql.Tx) error {
+		var hasUnsentEvents bool
+		query := fmt.Sprintf(l.names.render(hasUnsentEventsPartialQuery), quotedPartition)
+		if err := tx.QueryRowContext(ctx, query).Scan(&hasUnsentEvents); err != nil {
+			return err
+		}
+
+		if hasUnsentEvents {
+			l.logger.Debug("Partition still has unsent events, keeping it", "partition", partition)
+			return nil
+		}
+
+		queries := []string{
+			fmt.Sprintf(l.names.render(deletePartitionDeliveriesPartialQuery), quotedPartition),
+			fmt.Sprintf(l.names.render(dropPartitionPartialQuery), quotedPartition),
+		}
+
+		if l.retention.Archive {
+			queries = append([]string{fmt.Sprintf(l.names.render(archivePartitionPartialQuery), quotedPartition)}, queries...)
+		}
+
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+
+		dropped = true
+
+		return nil
+	})
+
+	return dropped, err
+}
@@ -0,0 +1,249 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+func (l *Listener) setupSnapshots(config Config) error {
+	for _, table := range config.Tables {
+		forced := slices.Contains(config.ForcedSnapshotTables, table.Name)
+		if table.Snapshot || forced {
+			l.pendingSnapshots = append(l.pendingSnapshots, table.Name)
+		}
+	}
+
+	for _, table := range config.ForcedSnapshotTables {
+		if _, exists := l.tables[table]; !exists {
+			return fmt.Errorf("can not snapshot table [%s], it is not listed on tables", table)
+		}
+	}
+
+	if len(l.pendingSnapshots) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	if _, err := l.db.ExecContext(ctx, l.names.render(setupFromToSnapshotTableQuery)); err != nil {
+		return err
+	}
+
+	for _, table := range l.pendingSnapshots {
+		query := l.names.render(startSnapshotQuery)
+		if slices.Contains(config.ForcedSnapshotTables, table) {
+			query = l.names.render(restartSnapshotQuery)
+		}
+
+		if _, err := l.db.ExecContext(ctx, query, table); err != nil {
+			return err
+		}
+	}
+
+	l.logger.Debug("Snapshot setup complete", "tables", l.pendingSnapshots)
+
+	return nil
+}
+
+// Copies the existing rows of every pending table into the event table as
+// read (R) events, in primary key order and in chunks. The progress is saved
+// with each chunk, so an interrupted snapshot resumes where it stopped
+func (l *Listener) snapshotPendingTables(ctx context.Context) error {
+	for len(l.pendingSnapshots) > 0 {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		table := l.pendingSnapshots[0]
+
+		completed, err := l.snapshotTable(ctx, table)
+		if err != nil {
+			return fmt.Errorf("Failed to snapshot table [%s], got error %s", table, err.Error())
+		}
+
+		if !completed {
+			return nil
+		}
+
+		l.pendingSnapshots = l.pendingSnapshots[1:]
+		l.logger.Info("Table snapshot completed", "table", table)
+	}
+
+	return nil
+}
+
+func (l *Listener) snapshotTable(ctx context.Context, name string) (bool, error) {
+	table := l.tables[name]
+
+	primaryKey := table.primaryKey
+	if len(primaryKey) == 0 {
+		return false, fmt.Errorf("table [%s] does not have a primary key", table.Name)
+	}
+
+	for ctx.Err() == nil {
+		completed, err := l.snapshotChunk(context.WithoutCancel(ctx), table, primaryKey)
+		if err != nil || completed {
+			return completed, err
+		}
+	}
+
+	return false, nil
+}
+
+func (l *Listener) snapshotChunk(ctx context.Context, table Table, primaryKey []string) (completed bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	err = l.transaction(ctx, func(tx *sql.Tx) error {
+		// Locking the progress row keeps concurrent instances from copying the
+		// same chunk twice
+		var lastKeyData []byte
+		if err := tx.QueryRowContext(ctx, l.names.render(lockSnapshotProgressQuery), table.Name).Scan(&lastKeyData, &completed); err != nil {
+			return err
+		}
+
+		if completed {
+			return nil
+		}
+
+		var lastKey []any
+		if lastKeyData != nil {
+			if err := json.Unmarshal(lastKeyData, &lastKey); err != nil {
+				return err
+			}
+		}
+
+		rows, chunkLastKey, err := l.getSnapshotChunk(ctx, tx, table, primaryKey, lastKey)
+		if err != nil {
+			return err
+		}
+
+		if len(rows) > 0 {
+			rowsData, err := json.Marshal(rows)
+			if err != nil {
+				return err
+			}
+
+			columnsFilter, err := table.ColumnsFilter()
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(
+				ctx,
+				l.names.render(insertSnapshotEventsQuery),
+				table.QuotedName(),
+				rowsData,
+				columnsFilter)
+			if err != nil {
+				return err
+			}
+
+			lastKey = chunkLastKey
+		}
+
+		completed = uint64(len(rows)) < l.snapshotChunkSize
+
+		lastKeyData, err = json.Marshal(lastKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, l.names.render(updateSnapshotProgressQuery), table.Name, lastKeyData, len(rows), completed)
+		if err != nil {
+			return err
+		}
+
+		l.logger.Debug("Snapshot chunk copied", "table", table.Name, "rows", len(rows), "lastKey", lastKey)
+
+		return nil
+	})
+
+	return completed, err
+}
+
+func (l *Listener) getSnapshotChunk(
+	ctx context.Context,
+	tx *sql.Tx,
+	table Table,
+	primaryKey []string,
+	lastKey []any,
+) ([]json.RawMessage, []any, error) {
+	columns := make([]string, 0, len(primaryKey))
+	textColumns := make([]string, 0, len(primaryKey))
+	for _, column := range primaryKey {
+		columns = append(columns, "new."+pq.QuoteIdentifier(column))
+		textColumns = append(textColumns, "new."+pq.QuoteIdentifier(column)+"::TEXT")
+	}
+
+	var conditions []string
+	if lastKey != nil {
+		params := make([]string, 0, len(lastKey))
+		for i := range lastKey {
+			params = append(params, fmt.Sprintf("$%d", i+1))
+		}
+
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s) > (%s)",
+			strings.Join(columns, ", "),
+			strings.Join(params, ", ")))
+	}
+
+	// Only copy the rows that the trigger would capture, the table is aliased
+	// as new so the condition applies as written
+	if table.When != "" {
+		conditions = append(conditions, "("+table.When+")")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(
+		getSnapshotChunkPartialQuery,
+		strings.Join(textColumns, ", "),
+		table.QuotedName(),
+		where,
+		strings.Join(columns, ", "),
+		l.snapshotChunkSize)
+
+	result, err := tx.QueryContext(ctx, query, lastKey...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer result.Close()
+
+	var rows []json.RawMessage
+	var key []any
+	for result.Next() {
+		keyValues := make([]string, len(primaryKey))
+		dest := make([]any, 0, len(primaryKey)+1)
+		for i := range keyValues {
+			dest = append(dest, &keyValues[i])
+		}
+
+		var row json.RawMessage
+		dest = append(dest, &row)
+
+		if err := result.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		key = make([]any, 0, len(keyValues))
+		for _, value := range keyValues {
+			key = append(key, value)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, key, result.Err()
+}
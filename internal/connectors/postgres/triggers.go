@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var _triggerEvents = map[string]string{
+	OperationInsert:   "INSERT",
+	OperationUpdate:   "UPDATE",
+	OperationDelete:   "DELETE",
+	OperationTruncate: "TRUNCATE",
+}
+
+// Creates one trigger per captured operation, so each one can have its own
+// WHEN clause, and drops the triggers of the operations no longer captured
+func (l *Listener) setupTableTrigger(tx *sql.Tx, table Table) error {
+	// Trigger names are scoped by table, so the schema is not needed to keep
+	// them unique
+	_, relation := table.SchemaAndRelation()
+
+	// The columns filter is passed as a trigger argument, so a single function
+	// serves every table
+	arguments := ""
+	if table.Columns.Enabled() {
+		columnsFilter, err := table.ColumnsFilter()
+		if err != nil {
+			return err
+		}
+
+		arguments = pq.QuoteLiteral(string(columnsFilter))
+	}
+
+	queries := []string{
+		fmt.Sprintf(
+			dropTriggerPartialQuery,
+			pq.QuoteIdentifier(l.names.legacyTriggerName(relation)),
+			table.QuotedName()),
+	}
+
+	for _, operation := range []string{OperationInsert, OperationUpdate, OperationDelete, OperationTruncate} {
+		triggerName := pq.QuoteIdentifier(l.names.triggerName(operation, relation))
+
+		if !slices.Contains(table.OperationsOrDefault(), operation) {
+			queries = append(queries, fmt.Sprintf(dropTriggerPartialQuery, triggerName, table.QuotedName()))
+			continue
+		}
+
+		// Truncates do not affect single rows, so they are captured once per
+		// statement and can not be filtered
+		level := "ROW"
+		when := l.triggerWhenClause(table, operation, arguments)
+		if operation == OperationTruncate {
+			level = "STATEMENT"
+			when = ""
+		}
+
+		queries = append(queries, fmt.Sprintf(
+			l.names.render(setupTableTriggerPartialQuery),
+			triggerName,
+			_triggerEvents[operation],
+			table.QuotedName(),
+			level,
+			when,
+			arguments))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the WHEN clause of the operation trigger, or an empty string if
+// every row is captured
+func (l *Listener) triggerWhenClause(table Table, operation string, columnsFilter string) string {
+	var conditions []string
+
+	if table.When != "" {
+		conditions = append(conditions, "("+table.When+")")
+	}
+
+	if operation == OperationUpdate && table.SkipUnchangedUpdates {
+		if table.Columns.Enabled() {
+			filterRow := l.names.render("{{filter_row}}")
+			conditions = append(conditions, fmt.Sprintf(
+				"%s(to_jsonb(OLD.*), %s) IS DISTINCT FROM %s(to_jsonb(NEW.*), %s)",
+				filterRow,
+				columnsFilter,
+				filterRow,
+				columnsFilter))
+		} else {
+			conditions = append(conditions, "OLD.* IS DISTINCT FROM NEW.*")
+		}
+	}
+
+	if len(conditions) == 0 {
+		return ""
+	}
+
+	return "WHEN (" + strings.Join(conditions, " AND ") + ")"
+}
@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/event"
+)
+
+const (
+	OperationInsert = event.OpInsert
+	OperationUpdate = event.OpUpdate
+	OperationDelete = event.OpDelete
+
+	// SQLite names the database of the opened file "main"
+	_mainSchema = "main"
+)
+
+type Table struct {
+	Name           string   `yaml:"name"`
+	ChangedColumns bool     `yaml:"changedColumns"`
+	Operations     []string `yaml:"operations"`
+
+	// Discovered from the database on setup, not configured
+	primaryKey []string
+}
+
+// Allows tables to be declared both as plain names and as objects with
+// per-table options
+func (t *Table) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := unmarshal(&t.Name); err == nil {
+		return nil
+	}
+
+	type table Table
+	return unmarshal((*table)(t))
+}
+
+func (t *Table) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("invalid empty table name")
+	}
+
+	for _, operation := range t.Operations {
+		switch operation {
+		case OperationInsert, OperationUpdate, OperationDelete:
+			continue
+		}
+
+		return fmt.Errorf(
+			"invalid operation [%s] for table [%s], expected one of: [%s, %s, %s]",
+			operation,
+			t.Name,
+			OperationInsert,
+			OperationUpdate,
+			OperationDelete)
+	}
+
+	return nil
+}
+
+func (t *Table) OperationsOrDefault() []string {
+	if len(t.Operations) == 0 {
+		return []string{OperationInsert, OperationUpdate, OperationDelete}
+	}
+
+	return t.Operations
+}
+
+type Config struct {
+	TimeoutSeconds uint64  `yaml:"timeoutSeconds"`
+	PollSeconds    uint64  `yaml:"pollSeconds"`
+	PollLimit      uint64  `yaml:"pollLimit"`
+	DSN            string  `yaml:"dsn"`
+	Tables         []Table `yaml:"tables"`
+	EventTable     string  `yaml:"eventTable"`
+	NamePrefix     string  `yaml:"namePrefix"`
+}
+
+func (c *Config) TimeoutSecondsOrDefault() time.Duration {
+	if c.TimeoutSeconds == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+func (c *Config) PollSecondsOrDefault() time.Duration {
+	if c.PollSeconds == 0 {
+		return 5 * time.Second
+	}
+
+	return time.Duration(c.PollSeconds) * time.Second
+}
+
+func (c *Config) LimitOrDefault() uint64 {
+	if c.PollLimit == 0 {
+		return 50
+	}
+
+	return c.PollLimit
+}
+
+func (c *Config) NamePrefixOrDefault() string {
+	if c.NamePrefix == "" {
+		return "from_to_"
+	}
+
+	return c.NamePrefix
+}
+
+func (c *Config) EventTableOrDefault() string {
+	if c.EventTable == "" {
+		return c.NamePrefixOrDefault() + "event"
+	}
+
+	return c.EventTable
+}
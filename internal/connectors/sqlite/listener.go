@@ -0,0 +1,289 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gustapinto/from-to/internal/connectors/eventtable"
+	"github.com/gustapinto/from-to/internal/event"
+	_ "modernc.org/sqlite"
+)
+
+// Layout of the timestamps written by strftime('%Y-%m-%d %H:%M:%f')
+const _timestampLayout = "2006-01-02 15:04:05.000"
+
+// Captures changes with triggers that write them to an event table inside the
+// SQLite file, which is polled for unsent events. A single instance is
+// expected per event table
+type Listener struct {
+	limit                  uint64
+	waitSeconds            time.Duration
+	timeout                time.Duration
+	db                     *sql.DB
+	logger                 *slog.Logger
+	tableToChannelRelation map[string][]event.Channel
+	tables                 map[string]Table
+	names                  objectNames
+	ledger                 eventtable.Ledger
+}
+
+func NewListener(config Config, channels map[string]event.Channel) (*Listener, error) {
+	listener := &Listener{
+		limit:       config.LimitOrDefault(),
+		waitSeconds: config.PollSecondsOrDefault(),
+		timeout:     config.TimeoutSecondsOrDefault(),
+		logger:      slog.With("listener", "SQLite"),
+		tables:      make(map[string]Table, len(config.Tables)),
+		names:       newObjectNames(config),
+	}
+
+	for _, table := range config.Tables {
+		if err := table.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if event.UsesTransactionMarkers(channels) {
+		listener.logger.Warn("Transaction markers are not supported by the sqlite input, ignoring")
+	}
+
+	if err := listener.connectToDatabase(config.DSN); err != nil {
+		return nil, err
+	}
+
+	if err := listener.setupDatabaseSchema(config, channels); err != nil {
+		return nil, err
+	}
+
+	listener.ledger = eventtable.Ledger{
+		DB:      listener.db,
+		Timeout: listener.timeout,
+		Logger:  listener.logger,
+		DeliveredChannelsQuery: func(ids []uint64) (string, []any) {
+			return eventtable.IDListQuery(listener.names.render(getDeliveredChannelsPartialQuery), ids)
+		},
+		SetEventsAsSentQuery: func(ids []uint64) (string, []any) {
+			return eventtable.IDListQuery(listener.names.render(setEventsAsSentPartialQuery), ids)
+		},
+		SaveDeliveryQuery: listener.names.render(saveDeliveryQuery),
+	}
+
+	listener.tableToChannelRelation = event.TableToChannelRelation(channels)
+	listener.logger.Info("Connector setup completed")
+
+	return listener, nil
+}
+
+// Runs until ctx is done, a batch is never interrupted halfway. SQLite has no
+// notifications, so new events are only found by polling
+func (l *Listener) Listen(ctx context.Context, callback func(event.Event, []event.Channel) ([]event.Delivery, error)) error {
+	for {
+		if err := l.processUnsentEvents(ctx, callback); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			l.logger.Info("Listener stopped")
+			return nil
+
+		case <-time.After(l.waitSeconds):
+			l.logger.Debug("Polling for new unsent events")
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return l.db.Close()
+}
+
+func (l *Listener) WriteDeadLetter(ctx context.Context, deadLetter event.DeadLetter) error {
+	return eventtable.WriteDeadLetter(ctx, l.db, l.names.render(insertDeadLetterQuery), l.timeout, deadLetter)
+}
+
+// The file is shared with the application that owns it, so writes wait for
+// its locks instead of failing right away. A single connection is kept, as
+// SQLite only allows one writer at a time anyway
+func (l *Listener) connectToDatabase(dsn string) error {
+	if !strings.Contains(dsn, "busy_timeout") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+
+		dsn += fmt.Sprintf("%s_pragma=busy_timeout(%d)", separator, l.timeout.Milliseconds())
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return err
+	}
+
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	l.db = db
+
+	l.logger.Debug("Connected to database", "dsn", dsn)
+	return nil
+}
+
+func (l *Listener) setupDatabaseSchema(config Config, channels map[string]event.Channel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := l.setupObjects(ctx, tx, config, channels); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (l *Listener) setupObjects(ctx context.Context, tx *sql.Tx, config Config, channels map[string]event.Channel) error {
+	queries := []string{
+		setupFromToEventTableQuery,
+		setupFromToEventSentIndexQuery,
+		setupFromToEventDeliveryTableQuery,
+	}
+
+	if event.UsesDeadLetterTable(channels) {
+		queries = append(queries, setupFromToDeadLetterTableQuery)
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, l.names.render(query)); err != nil {
+			return err
+		}
+	}
+
+	l.logger.Debug("Event table setup complete")
+
+	for _, table := range config.Tables {
+		if err := l.setupTableTrigger(ctx, tx, table); err != nil {
+			return err
+		}
+
+		primaryKey, err := queryColumns(ctx, tx, getPrimaryKeyColumnsQuery, table.Name)
+		if err != nil {
+			return err
+		}
+
+		if len(primaryKey) == 0 {
+			l.logger.Debug("Table does not have a primary key, its events have no key", "table", table.Name)
+		}
+
+		table.primaryKey = primaryKey
+		l.tables[table.Name] = table
+
+		l.logger.Debug("Table setup complete", "table", table.Name)
+	}
+
+	return nil
+}
+
+func (l *Listener) processUnsentEvents(
+	ctx context.Context,
+	callback func(event.Event, []event.Channel) ([]event.Delivery, error),
+) error {
+	for ctx.Err() == nil {
+		batchCtx := context.WithoutCancel(ctx)
+
+		events, err := l.getEventsToSend(batchCtx)
+		if err != nil {
+			return err
+		}
+
+		if len(events) > 0 {
+			l.logger.Info(fmt.Sprintf("Processing %d events", len(events)))
+		}
+
+		allDone, err := l.ledger.PublishBatch(batchCtx, events, l.tableToChannelRelation, callback)
+		if err != nil {
+			return err
+		}
+
+		// Keep reading while full batches come back, unless an event of this
+		// one failed and would be read again right away
+		if !allDone || uint64(len(events)) < l.limit {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// SQLite serializes writers, so ids follow the commit order of the changes
+func (l *Listener) getEventsToSend(ctx context.Context) ([]event.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	rows, err := l.db.QueryContext(ctx, l.names.render(getEventsToSendQuery), l.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []event.Event
+	for rows.Next() {
+		var e event.Event
+		var data string
+		var before, timestamp sql.NullString
+		err := rows.Scan(
+			&e.ID,
+			&e.Op,
+			&e.Schema,
+			&e.Table,
+			&data,
+			&before,
+			&e.Ts,
+			&timestamp,
+			&e.Sent)
+		if err != nil {
+			return nil, err
+		}
+
+		if timestamp.Valid {
+			e.Timestamp, err = time.Parse(_timestampLayout, timestamp.String)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		table := l.tables[e.Table]
+
+		if err := json.Unmarshal([]byte(data), &e.Row); err != nil {
+			return nil, err
+		}
+
+		e.Key = event.KeyFromRow(table.primaryKey, e.Row)
+
+		if before.Valid {
+			if err := json.Unmarshal([]byte(before.String), &e.Before); err != nil {
+				return nil, err
+			}
+
+			if table.ChangedColumns {
+				e.Changed = event.ChangedColumns(e.Before, e.Row)
+			}
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
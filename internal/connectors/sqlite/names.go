@@ -0,0 +1,44 @@
+package sqlite
+
+import "strings"
+
+// Names of the objects created on the database file, rendered into the
+// queries in place of their placeholders
+type objectNames struct {
+	prefix     string
+	eventTable string
+	replacer   *strings.Replacer
+}
+
+func newObjectNames(config Config) objectNames {
+	names := objectNames{
+		prefix:     config.NamePrefixOrDefault(),
+		eventTable: config.EventTableOrDefault(),
+	}
+
+	names.replacer = strings.NewReplacer(
+		"{{event}}", quoteIdentifier(names.eventTable),
+		"{{event_sent_index}}", quoteIdentifier(names.eventTable+"_sent_id_idx"),
+		"{{delivery}}", quoteIdentifier(names.eventTable+"_delivery"),
+		"{{dead_letter}}", quoteIdentifier(names.prefix+"dead_letter"),
+	)
+
+	return names
+}
+
+// Replaces the object name placeholders of the query
+func (n *objectNames) render(query string) string {
+	return n.replacer.Replace(query)
+}
+
+func (n *objectNames) triggerName(operation string, table string) string {
+	return n.prefix + strings.ToLower(_triggerEvents[operation]) + "_" + table + "_trigger"
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,173 @@
+package sqlite
+
+const (
+	setupFromToEventTableQuery = `
+	CREATE TABLE IF NOT EXISTS {{event}} (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"op" TEXT NOT NULL,
+		"schema" TEXT NOT NULL,
+		"table" TEXT NOT NULL,
+		"row" TEXT NOT NULL,
+		"before" TEXT,
+		"ts" INTEGER NOT NULL,
+		"statement_ts" TEXT,
+		"sent" INTEGER NOT NULL DEFAULT 0
+	)
+	`
+
+	setupFromToEventSentIndexQuery = `
+	CREATE INDEX IF NOT EXISTS {{event_sent_index}} ON {{event}} ("sent", "id")
+	`
+
+	setupFromToEventDeliveryTableQuery = `
+	CREATE TABLE IF NOT EXISTS {{delivery}} (
+		"event_id" INTEGER NOT NULL,
+		"channel" TEXT NOT NULL,
+		"status" TEXT NOT NULL,
+		"attempts" INTEGER NOT NULL DEFAULT 0,
+		"last_error" TEXT,
+		"updated_at" TEXT NOT NULL,
+		PRIMARY KEY ("event_id", "channel")
+	)
+	`
+
+	setupFromToDeadLetterTableQuery = `
+	CREATE TABLE IF NOT EXISTS {{dead_letter}} (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"event_id" INTEGER NOT NULL,
+		"channel" TEXT NOT NULL,
+		"event" TEXT NOT NULL,
+		"payload" TEXT,
+		"error" TEXT NOT NULL,
+		"attempts" INTEGER NOT NULL,
+		"created_at" TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+	)
+	`
+
+	getTableColumnsQuery = `
+	SELECT
+		p.name
+	FROM
+		pragma_table_info(?) p
+	ORDER BY
+		p.cid
+	`
+
+	getPrimaryKeyColumnsQuery = `
+	SELECT
+		p.name
+	FROM
+		pragma_table_info(?) p
+	WHERE
+		p.pk > 0
+	ORDER BY
+		p.pk
+	`
+
+	getTriggerStatementQuery = `
+	SELECT
+		m.sql
+	FROM
+		sqlite_master m
+	WHERE
+		m.type = 'trigger'
+		AND m.name = ?
+	`
+
+	// Formatted with the trigger name, the event, the table name and the
+	// statement
+	setupTableTriggerPartialQuery = `CREATE TRIGGER %s AFTER %s ON %s FOR EACH ROW BEGIN %s; END`
+
+	// Formatted with the operation, table, row and before literals. SQLite has
+	// no statement timestamp, the time of the change is used instead
+	insertEventPartialStatement = `INSERT INTO {{event}} ("op", "schema", "table", "row", "before", "ts", "statement_ts") ` +
+		`VALUES (%s, 'main', %s, %s, %s, CAST(strftime('%%s', 'now') AS INTEGER), strftime('%%Y-%%m-%%d %%H:%%M:%%f', 'now'))`
+
+	dropTriggerPartialQuery = `
+	DROP TRIGGER IF EXISTS %s
+	`
+
+	getEventsToSendQuery = `
+	SELECT
+		fte."id",
+		fte."op",
+		fte."schema",
+		fte."table",
+		fte."row",
+		fte."before",
+		fte."ts",
+		fte."statement_ts",
+		fte."sent"
+	FROM
+		{{event}} fte
+	WHERE
+		fte."sent" = 0
+	ORDER BY
+		fte."id" ASC
+	LIMIT
+		?
+	`
+
+	// Formatted with a placeholder for each id
+	setEventsAsSentPartialQuery = `
+	UPDATE
+		{{event}}
+	SET
+		"sent" = 1
+	WHERE
+		"id" IN (%s)
+	`
+
+	// Formatted with a placeholder for each id
+	getDeliveredChannelsPartialQuery = `
+	SELECT
+		fted."event_id",
+		fted."channel"
+	FROM
+		{{delivery}} fted
+	WHERE
+		fted."event_id" IN (%s)
+		AND fted."status" = 'delivered'
+	`
+
+	saveDeliveryQuery = `
+	INSERT INTO {{delivery}} (
+		"event_id",
+		"channel",
+		"status",
+		"attempts",
+		"last_error",
+		"updated_at"
+	) VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		strftime('%Y-%m-%d %H:%M:%f', 'now')
+	)
+	ON CONFLICT ("event_id", "channel") DO UPDATE SET
+		"status" = excluded."status",
+		"attempts" = "attempts" + excluded."attempts",
+		"last_error" = excluded."last_error",
+		"updated_at" = excluded."updated_at"
+	`
+
+	insertDeadLetterQuery = `
+	INSERT INTO {{dead_letter}} (
+		"event_id",
+		"channel",
+		"event",
+		"payload",
+		"error",
+		"attempts"
+	) VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		?
+	)
+	`
+)
@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var _triggerEvents = map[string]string{
+	OperationInsert: "INSERT",
+	OperationUpdate: "UPDATE",
+	OperationDelete: "DELETE",
+}
+
+// Triggers are only dropped and created again when their statement changed,
+// such as after a column was added to the table. SQLite runs both in the same
+// transaction, so no change is missed in between
+func (l *Listener) setupTableTrigger(ctx context.Context, tx *sql.Tx, table Table) error {
+	columns, err := queryColumns(ctx, tx, getTableColumnsQuery, table.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(columns) == 0 {
+		return fmt.Errorf("table [%s] does not exist", table.Name)
+	}
+
+	operations := table.OperationsOrDefault()
+	for _, operation := range []string{OperationInsert, OperationUpdate, OperationDelete} {
+		name := l.names.triggerName(operation, table.Name)
+
+		if !slices.Contains(operations, operation) {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(dropTriggerPartialQuery, quoteIdentifier(name))); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		statement := fmt.Sprintf(
+			setupTableTriggerPartialQuery,
+			quoteIdentifier(name),
+			_triggerEvents[operation],
+			quoteIdentifier(table.Name),
+			l.triggerStatement(table, operation, columns))
+
+		installed, err := getTriggerStatement(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+
+		if installed == statement {
+			continue
+		}
+
+		queries := []string{
+			fmt.Sprintf(dropTriggerPartialQuery, quoteIdentifier(name)),
+			statement,
+		}
+
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to setup trigger [%s], got error %s", name, err.Error())
+			}
+		}
+
+		l.logger.Debug("Trigger installed", "trigger", name, "table", table.Name)
+	}
+
+	return nil
+}
+
+// Builds the statement that inserts the event, the rows are built with
+// json_object over the columns the table had when the trigger was created
+func (l *Listener) triggerStatement(table Table, operation string, columns []string) string {
+	row := jsonObject("NEW", columns)
+	before := "NULL"
+
+	switch operation {
+	case OperationUpdate:
+		before = jsonObject("OLD", columns)
+	case OperationDelete:
+		row = jsonObject("OLD", columns)
+	}
+
+	return fmt.Sprintf(
+		l.names.render(insertEventPartialStatement),
+		quoteLiteral(operation),
+		quoteLiteral(table.Name),
+		row,
+		before)
+}
+
+// JSON can not hold blobs, so they are written as hex strings
+func jsonObject(reference string, columns []string) string {
+	arguments := make([]string, 0, len(columns))
+	for _, column := range columns {
+		value := reference + "." + quoteIdentifier(column)
+		arguments = append(arguments, fmt.Sprintf(
+			"%s, CASE WHEN typeof(%s) = 'blob' THEN hex(%s) ELSE %s END",
+			quoteLiteral(column),
+			value,
+			value,
+			value))
+	}
+
+	return "json_object(" + strings.Join(arguments, ", ") + ")"
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func queryColumns(ctx context.Context, db queryer, query string, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// Returns an empty statement if the trigger is not installed
+func getTriggerStatement(ctx context.Context, db queryer, name string) (string, error) {
+	var statement string
+	err := db.QueryRowContext(ctx, getTriggerStatementQuery, name).Scan(&statement)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return statement, err
+}
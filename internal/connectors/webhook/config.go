@@ -6,7 +6,11 @@ type Config struct {
 	URL            string            `yaml:"url"`
 	Headers        map[string]string `yaml:"headers"`
 	TimeoutSeconds uint64            `yaml:"requestTimeout"`
-	Retries        *uint64           `yaml:"retries"`
+
+	// Deprecated: use the channel retry policy instead. Until it is removed
+	// it still sets the max attempts of the channels that publish to the
+	// webhook and do not set their own
+	Retries *uint64 `yaml:"retries"`
 }
 
 func (c *Config) HeadersOrDefault() map[string]string {
@@ -2,6 +2,7 @@ package webhook
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,30 +12,58 @@ import (
 
 type Publisher struct {
 	url     string
-	retries uint64
 	headers map[string]string
 	client  *http.Client
 	logger  *slog.Logger
 }
 
 func NewPublisher(config Config) *Publisher {
-	return &Publisher{
+	publisher := &Publisher{
 		url:     config.URL,
-		retries: config.RetriesOrDefault(),
 		headers: config.HeadersOrDefault(),
 		client: &http.Client{
 			Timeout: config.TimeoutSecondsOrDefault(),
 		},
 		logger: slog.With("publisher", "Webhook"),
 	}
+
+	if config.Retries != nil {
+		publisher.logger.Warn("The webhook retries option is deprecated, use the channel retry policy instead")
+	}
+
+	return publisher
+}
+
+// Sends a single request, failed requests are retried by the channel retry
+// policy, which waits between attempts. Requests are not keyed, so the record
+// key is ignored
+func (p *Publisher) Publish(ctx context.Context, e event.Event, _ []byte, payload []byte) error {
+	if err := p.post(ctx, payload); err != nil {
+		return err
+	}
+
+	p.logger.Debug(
+		"Row published",
+		"id", e.ID,
+		"url", p.url,
+		"payload", string(payload),
+	)
+
+	return nil
 }
 
-func (p *Publisher) Publish(e event.Event, payload []byte) error {
-	body := bytes.NewBuffer(payload)
+func (p *Publisher) Close() error {
+	p.client.CloseIdleConnections()
 
-	req, err := http.NewRequest(http.MethodPost, p.url, body)
+	return nil
+}
+
+// Sends the payload once, classifying client errors (except timeouts and rate
+// limits) as permanent since retrying the same payload would not succeed
+func (p *Publisher) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
 	if err != nil {
-		return err
+		return event.Permanent(err)
 	}
 
 	req.Header.Add("Content-Type", "application/json")
@@ -43,28 +72,22 @@ func (p *Publisher) Publish(e event.Event, payload []byte) error {
 		req.Header.Add(header, value)
 	}
 
-	tries := uint64(0)
-	for tries < p.retries {
-		res, err := p.client.Do(req)
-		if err != nil {
-			return err
-		}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
 
-		if res.StatusCode == http.StatusNoContent {
-			return nil
-		}
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
 
-		p.logger.Debug("Endpoint returned non 204 response, retrying")
+	err = fmt.Errorf("endpoint returned non 204 response %d", res.StatusCode)
 
-		tries += 1
+	isClientError := res.StatusCode >= 400 && res.StatusCode < 500
+	if isClientError && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+		return event.Permanent(err)
 	}
 
-	p.logger.Debug(
-		"Row published",
-		"id", e.ID,
-		"url", p.url,
-		"payload", string(payload),
-	)
-
-	return fmt.Errorf("maximum tries exceeded for event %d", e.ID)
+	return err
 }
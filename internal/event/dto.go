@@ -1,14 +1,44 @@
 package event
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
 
+const (
+	OpInsert   = "I"
+	OpUpdate   = "U"
+	OpDelete   = "D"
+	OpRead     = "R"
+	OpTruncate = "T"
+	OpCommit   = "C"
+)
+
+// Events of the truncate (T) operation do not carry any row, they mean that
+// every row of the table was removed. Events of the commit (C) operation mark
+// the end of a transaction, their row holds how many events each table had on
+// it under "tables". The key holds the primary key columns of the row, and the
+// headers hold the headers of the source message on message based inputs.
+// Unchanged holds the columns that were left out of the row because the source
+// did not send their value, as with unchanged TOAST values on replication
 type Event struct {
-	ID    uint64         `json:"id,omitempty"`
-	Ts    uint64         `json:"ts,omitempty"`
-	Op    string         `json:"op,omitempty"`
-	Table string         `json:"table,omitempty"`
-	Row   map[string]any `json:"row,omitempty"`
-	Sent  bool           `json:"sent,omitempty"`
+	ID        uint64         `json:"id,omitempty"`
+	Ts        uint64         `json:"ts,omitempty"`
+	Timestamp time.Time      `json:"timestamp,omitzero"`
+	TxID      uint64         `json:"txid,omitempty"`
+	TxSeq     uint64         `json:"txseq,omitempty"`
+	Op        string         `json:"op,omitempty"`
+	Schema    string         `json:"schema,omitempty"`
+	Table     string         `json:"table,omitempty"`
+	Key       map[string]any `json:"key,omitempty"`
+	Row       map[string]any `json:"row,omitempty"`
+	Before    map[string]any `json:"before,omitempty"`
+	Changed   []string       `json:"changed,omitempty"`
+	Unchanged []string       `json:"unchanged,omitempty"`
+	Headers   map[string]any `json:"headers,omitempty"`
+	Sent      bool           `json:"sent,omitempty"`
 }
 
 func (e Event) String() string {
@@ -17,19 +47,78 @@ func (e Event) String() string {
 		e.ID,
 		e.Ts,
 		e.Op,
-		e.Table,
+		e.QualifiedTable(),
 		e.Sent,
 	)
 }
 
+// Returns the table name prefixed by its schema, or only the table name if the
+// schema is unknown
+func (e Event) QualifiedTable() string {
+	if e.Schema == "" {
+		return e.Table
+	}
+
+	return e.Schema + "." + e.Table
+}
+
+// Returns the sorted names of the columns in after whose value differs from
+// before. Columns missing from after are considered unchanged
+func ChangedColumns(before, after map[string]any) []string {
+	changed := make([]string, 0, len(after))
+	for column, value := range after {
+		if !reflect.DeepEqual(before[column], value) {
+			changed = append(changed, column)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed
+}
+
+type DeadLetterConfig struct {
+	To    string `yaml:"to"`
+	Table bool   `yaml:"table"`
+}
+
+func (dlc DeadLetterConfig) Enabled() bool {
+	return dlc.To != "" || dlc.Table
+}
+
 type Channel struct {
-	From   string `yaml:"from"`
-	To     string `yaml:"to"`
-	Mapper string `yaml:"mapper"`
+	From       string           `yaml:"from"`
+	To         string           `yaml:"to"`
+	Mapper     string           `yaml:"mapper"`
+	DeadLetter DeadLetterConfig `yaml:"deadLetter"`
+	Retry      RetryConfig      `yaml:"retry"`
+
+	RecordKey RecordKeyConfig `yaml:"recordKey"`
+	Ordering  string          `yaml:"ordering"`
+
+	// Also receive a commit (C) event after the events of each transaction
+	// that changed the channel table
+	TransactionMarkers bool `yaml:"transactionMarkers"`
 
 	Key string `yaml:"-"`
 }
 
+func (c Channel) OrderingOrDefault() string {
+	if c.Ordering == "" {
+		return OrderingNone
+	}
+
+	return c.Ordering
+}
+
+func (c Channel) Validate() error {
+	if err := c.RecordKey.Validate(); err != nil {
+		return err
+	}
+
+	return validateOrdering(c.OrderingOrDefault())
+}
+
 func (c Channel) String() string {
 	return fmt.Sprintf(
 		"Channel[From=%s, To=%s, Mapper=%s, Key=%s]",
@@ -39,3 +128,50 @@ func (c Channel) String() string {
 		c.Key,
 	)
 }
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusDelivered    DeliveryStatus = "delivered"
+	DeliveryStatusDeadLettered DeliveryStatus = "dead_letter"
+	DeliveryStatusFailed       DeliveryStatus = "failed"
+)
+
+type Delivery struct {
+	Channel  Channel
+	Status   DeliveryStatus
+	Attempts uint64
+	Err      error
+}
+
+func (d Delivery) Done() bool {
+	return d.Status == DeliveryStatusDelivered || d.Status == DeliveryStatusDeadLettered
+}
+
+func (d Delivery) String() string {
+	return fmt.Sprintf(
+		"Delivery[Channel=%s, Status=%s, Attempts=%d, Err=%v]",
+		d.Channel.Key,
+		d.Status,
+		d.Attempts,
+		d.Err,
+	)
+}
+
+type DeadLetter struct {
+	Event    Event  `json:"event"`
+	Payload  string `json:"payload,omitempty"`
+	Channel  string `json:"channel"`
+	Error    string `json:"error"`
+	Attempts uint64 `json:"attempts"`
+}
+
+func (dl DeadLetter) String() string {
+	return fmt.Sprintf(
+		"DeadLetter[Event=%d, Channel=%s, Attempts=%d, Error=%s]",
+		dl.Event.ID,
+		dl.Channel,
+		dl.Attempts,
+		dl.Error,
+	)
+}
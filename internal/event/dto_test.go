@@ -0,0 +1,32 @@
+package event
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   map[string]any
+		after    map[string]any
+		expected []string
+	}{
+		{"unchanged", map[string]any{"id": 1.0, "name": "a"}, map[string]any{"id": 1.0, "name": "a"}, []string{}},
+		{"sorted", map[string]any{"id": 1.0, "b": "x", "a": "x"}, map[string]any{"id": 1.0, "b": "y", "a": "y"}, []string{"a", "b"}},
+		{"set to null", map[string]any{"name": "a"}, map[string]any{"name": nil}, []string{"name"}},
+		{"added column", map[string]any{"id": 1.0}, map[string]any{"id": 1.0, "name": "a"}, []string{"name"}},
+		{"missing from after", map[string]any{"id": 1.0, "name": "a"}, map[string]any{"id": 1.0}, []string{}},
+		{"nested values", map[string]any{"tags": []any{"a"}}, map[string]any{"tags": []any{"a", "b"}}, []string{"tags"}},
+		{"no before", nil, map[string]any{"id": 1.0}, []string{"id"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changed := ChangedColumns(test.before, test.after)
+			if !reflect.DeepEqual(changed, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, changed)
+			}
+		})
+	}
+}
@@ -1,13 +1,28 @@
 package event
 
+import "context"
+
 type Mapper interface {
-	Map(Event) ([]byte, error)
+	Map(ctx context.Context, event Event) ([]byte, error)
+	Close() error
+}
+
+// Mappers that can also choose the record key of the mapped payload, used by
+// channels with the mapper record key strategy
+type KeyMapper interface {
+	MapWithKey(ctx context.Context, event Event) (payload []byte, key []byte, err error)
 }
 
 type Listener interface {
-	Listen(func(event Event, channels []Channel) error) error
+	Listen(ctx context.Context, callback func(event Event, channels []Channel) ([]Delivery, error)) error
+	Close() error
 }
 
 type Publisher interface {
-	Publish(event Event, payload []byte) error
+	Publish(ctx context.Context, event Event, key []byte, payload []byte) error
+	Close() error
+}
+
+type DeadLetterWriter interface {
+	WriteDeadLetter(ctx context.Context, deadLetter DeadLetter) error
 }
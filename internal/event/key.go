@@ -0,0 +1,97 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	RecordKeyID         = "id"
+	RecordKeyPrimaryKey = "primaryKey"
+	RecordKeyFields     = "fields"
+	RecordKeyMapper     = "mapper"
+)
+
+// How the key of the records published on a channel is chosen, which decides
+// the partition of the record on outputs such as Kafka
+type RecordKeyConfig struct {
+	Strategy string   `yaml:"strategy"`
+	Fields   []string `yaml:"fields"`
+}
+
+func (rc *RecordKeyConfig) StrategyOrDefault() string {
+	if rc.Strategy == "" {
+		return RecordKeyID
+	}
+
+	return rc.Strategy
+}
+
+// Returns the record key of the event. The primary key and fields strategies
+// encode the key as a JSON object, and return no key for events without a row
+func (rc *RecordKeyConfig) Key(e Event) ([]byte, error) {
+	switch rc.StrategyOrDefault() {
+	case RecordKeyID:
+		return []byte(strconv.FormatUint(e.ID, 10)), nil
+
+	case RecordKeyPrimaryKey:
+		if e.Key == nil {
+			return nil, nil
+		}
+
+		return json.Marshal(e.Key)
+
+	case RecordKeyFields:
+		if e.Row == nil {
+			return nil, nil
+		}
+
+		return json.Marshal(KeyFromRow(rc.Fields, e.Row))
+	}
+
+	return nil, rc.Validate()
+}
+
+func (rc *RecordKeyConfig) Validate() error {
+	switch rc.StrategyOrDefault() {
+	case RecordKeyID, RecordKeyPrimaryKey, RecordKeyMapper:
+		return nil
+
+	case RecordKeyFields:
+		if len(rc.Fields) == 0 {
+			return errors.New("record key strategy [fields] requires at least one field")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf(
+		"invalid record key strategy [%s], expected one of: [%s, %s, %s, %s]",
+		rc.Strategy,
+		RecordKeyID,
+		RecordKeyPrimaryKey,
+		RecordKeyFields,
+		RecordKeyMapper)
+}
+
+// Returns the values of the key columns on the row, or nil if there are no
+// key columns or the row does not have them
+func KeyFromRow(columns []string, row map[string]any) map[string]any {
+	if len(columns) == 0 || row == nil {
+		return nil
+	}
+
+	key := make(map[string]any, len(columns))
+	for _, column := range columns {
+		value, exists := row[column]
+		if !exists {
+			return nil
+		}
+
+		key[column] = value
+	}
+
+	return key
+}
@@ -0,0 +1,61 @@
+package event
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyFromRow(t *testing.T) {
+	row := map[string]any{"id": 1.0, "tenant": "a", "name": nil}
+
+	tests := []struct {
+		name     string
+		columns  []string
+		row      map[string]any
+		expected map[string]any
+	}{
+		{"single column", []string{"id"}, row, map[string]any{"id": 1.0}},
+		{"composite key", []string{"tenant", "id"}, row, map[string]any{"tenant": "a", "id": 1.0}},
+		{"null value", []string{"name"}, row, map[string]any{"name": nil}},
+		{"missing column", []string{"id", "other"}, row, nil},
+		{"no columns", nil, row, nil},
+		{"no row", []string{"id"}, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := KeyFromRow(test.columns, test.row); !reflect.DeepEqual(key, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	e := Event{ID: 42, Key: map[string]any{"id": 1.0}, Row: map[string]any{"id": 1.0, "tenant": "a"}}
+
+	tests := []struct {
+		config   RecordKeyConfig
+		expected string
+	}{
+		{RecordKeyConfig{}, "42"},
+		{RecordKeyConfig{Strategy: RecordKeyPrimaryKey}, `{"id":1}`},
+		{RecordKeyConfig{Strategy: RecordKeyFields, Fields: []string{"tenant"}}, `{"tenant":"a"}`},
+	}
+
+	for _, test := range tests {
+		key, err := test.config.Key(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(key) != test.expected {
+			t.Errorf("strategy %s: expected %s, got %s", test.config.StrategyOrDefault(), test.expected, key)
+		}
+	}
+
+	primaryKey := RecordKeyConfig{Strategy: RecordKeyPrimaryKey}
+	if key, err := primaryKey.Key(Event{ID: 1}); err != nil || key != nil {
+		t.Errorf("events without a key should have no record key, got %s and %v", key, err)
+	}
+}
@@ -0,0 +1,143 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	OrderingNone   = "none"
+	OrderingGlobal = "global"
+	OrderingTable  = "table"
+	OrderingKey    = "key"
+)
+
+// Keeps the events of a channel in order when one of them fails. Once an
+// event fails, the later events on its scope (every event, its table or its
+// key) are held until it is delivered. Inputs publish a batch again starting
+// from its oldest undelivered event, so the holds are released whenever an
+// event comes that is not newer than the last one
+type orderingHolds struct {
+	mu     sync.Mutex
+	lastID uint64
+	seen   bool
+
+	// Scopes held on each channel, and the id of the event holding them
+	held map[string]map[string]uint64
+}
+
+func newOrderingHolds() *orderingHolds {
+	return &orderingHolds{
+		held: make(map[string]map[string]uint64),
+	}
+}
+
+func (o *orderingHolds) startEvent(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.seen && e.ID <= o.lastID {
+		clear(o.held)
+	}
+
+	o.lastID = e.ID
+	o.seen = true
+}
+
+// Returns the id of the event holding the event on the channel, if any
+func (o *orderingHolds) heldBy(channel Channel, e Event) (uint64, bool) {
+	scope, ok := orderingScope(channel, e)
+	if !ok {
+		return 0, false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for heldScope, id := range o.held[channel.Key] {
+		if id != e.ID && scopesOverlap(scope, heldScope) {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// Holds the scope of a failed event, or releases it once the event that held
+// it is done
+func (o *orderingHolds) record(channel Channel, e Event, done bool) {
+	scope, ok := orderingScope(channel, e)
+	if !ok {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	held := o.held[channel.Key]
+	if done {
+		for heldScope, id := range held {
+			if id == e.ID {
+				delete(held, heldScope)
+			}
+		}
+
+		return
+	}
+
+	if held == nil {
+		held = make(map[string]uint64)
+		o.held[channel.Key] = held
+	}
+
+	if _, exists := held[scope]; !exists {
+		held[scope] = e.ID
+	}
+}
+
+// Scopes are nested as "table/key", events without a key (such as truncates)
+// are scoped to their whole table
+func orderingScope(channel Channel, e Event) (string, bool) {
+	switch channel.OrderingOrDefault() {
+	case OrderingGlobal:
+		return "", true
+
+	case OrderingTable:
+		return e.QualifiedTable(), true
+
+	case OrderingKey:
+		if e.Key == nil {
+			return e.QualifiedTable(), true
+		}
+
+		key, err := json.Marshal(e.Key)
+		if err != nil {
+			return e.QualifiedTable(), true
+		}
+
+		return e.QualifiedTable() + "/" + string(key), true
+	}
+
+	return "", false
+}
+
+func scopesOverlap(a string, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+func validateOrdering(ordering string) error {
+	switch ordering {
+	case OrderingNone, OrderingGlobal, OrderingTable, OrderingKey:
+		return nil
+	}
+
+	return fmt.Errorf(
+		"invalid ordering [%s], expected one of: [%s, %s, %s, %s]",
+		ordering,
+		OrderingNone,
+		OrderingGlobal,
+		OrderingTable,
+		OrderingKey)
+}
@@ -0,0 +1,97 @@
+package event
+
+import "testing"
+
+func TestOrderingHolds(t *testing.T) {
+	channel := Channel{Key: "sales", Ordering: OrderingKey}
+	first := Event{ID: 1, Table: "sales", Key: map[string]any{"id": 1.0}}
+	sameKey := Event{ID: 2, Table: "sales", Key: map[string]any{"id": 1.0}}
+	otherKey := Event{ID: 3, Table: "sales", Key: map[string]any{"id": 2.0}}
+	truncate := Event{ID: 4, Table: "sales"}
+
+	holds := newOrderingHolds()
+	holds.startEvent(first)
+	holds.record(channel, first, false)
+
+	holds.startEvent(sameKey)
+	if id, held := holds.heldBy(channel, sameKey); !held || id != 1 {
+		t.Errorf("an event of the same key should be held by event 1, got %d and %t", id, held)
+	}
+
+	holds.startEvent(otherKey)
+	if _, held := holds.heldBy(channel, otherKey); held {
+		t.Error("an event of another key should not be held")
+	}
+
+	// Keyless events are scoped to their table, which overlaps every key
+	holds.startEvent(truncate)
+	if _, held := holds.heldBy(channel, truncate); !held {
+		t.Error("an event without a key should be held by any key of its table")
+	}
+
+	if _, held := holds.heldBy(Channel{Key: "other", Ordering: OrderingKey}, sameKey); held {
+		t.Error("holds of a channel should not affect other channels")
+	}
+
+	if _, held := holds.heldBy(Channel{Key: "sales"}, sameKey); held {
+		t.Error("channels without ordering should never be held")
+	}
+
+	if _, held := holds.heldBy(channel, first); held {
+		t.Error("an event should not be held by itself")
+	}
+
+	holds.record(channel, first, true)
+	if _, held := holds.heldBy(channel, sameKey); held {
+		t.Error("the hold should be released once the event that held it is delivered")
+	}
+}
+
+func TestOrderingHoldsReleasedOnReplay(t *testing.T) {
+	channel := Channel{Key: "sales", Ordering: OrderingGlobal}
+	failed := Event{ID: 5, Table: "sales"}
+	later := Event{ID: 6, Table: "customers"}
+
+	holds := newOrderingHolds()
+	holds.startEvent(failed)
+	holds.record(channel, failed, false)
+
+	holds.startEvent(later)
+	if _, held := holds.heldBy(channel, later); !held {
+		t.Error("global ordering should hold every later event")
+	}
+
+	// An event that is not newer than the last one starts a new pass over
+	// the batch, so the previous holds are released
+	holds.startEvent(Event{ID: 5, Table: "sales"})
+	holds.startEvent(later)
+	if _, held := holds.heldBy(channel, later); held {
+		t.Error("holds should be released when the batch is published again")
+	}
+}
+
+func TestOrderingScope(t *testing.T) {
+	e := Event{Schema: "public", Table: "sales", Key: map[string]any{"id": 1.0}}
+
+	tests := []struct {
+		ordering string
+		expected string
+		ok       bool
+	}{
+		{OrderingNone, "", false},
+		{OrderingGlobal, "", true},
+		{OrderingTable, "public.sales", true},
+		{OrderingKey, `public.sales/{"id":1}`, true},
+	}
+
+	for _, test := range tests {
+		scope, ok := orderingScope(Channel{Ordering: test.ordering}, e)
+		if scope != test.expected || ok != test.ok {
+			t.Errorf("ordering %s: expected %q and %t, got %q and %t", test.ordering, test.expected, test.ok, scope, ok)
+		}
+	}
+
+	if !scopesOverlap("public.sales", `public.sales/{"id":1}`) || scopesOverlap("public.sales", "public.sales_archive") {
+		t.Error("a table scope should only overlap the keys of the same table")
+	}
+}
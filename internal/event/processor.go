@@ -1,18 +1,24 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type Processor struct {
-	listener   Listener
-	publishers map[string]Publisher
-	mappers    map[string]Mapper
-	channels   map[string]Channel
-	logger     *slog.Logger
+	listener     Listener
+	publishers   map[string]Publisher
+	mappers      map[string]Mapper
+	channels     map[string]Channel
+	drainTimeout time.Duration
+	ordering     *orderingHolds
+	logger       *slog.Logger
 }
 
 func NewProcessor(
@@ -20,23 +26,64 @@ func NewProcessor(
 	publishers map[string]Publisher,
 	mappers map[string]Mapper,
 	channels map[string]Channel,
+	drainTimeout time.Duration,
 ) *Processor {
 	return &Processor{
-		listener:   listener,
-		publishers: publishers,
-		mappers:    mappers,
-		channels:   channels,
-		logger:     slog.Default(),
+		listener:     listener,
+		publishers:   publishers,
+		mappers:      mappers,
+		channels:     channels,
+		drainTimeout: drainTimeout,
+		ordering:     newOrderingHolds(),
+		logger:       slog.Default(),
 	}
 }
 
-func (p *Processor) ListenAndProcess() error {
-	return p.listener.Listen(p.publishEventToAllChannels)
+// Listens and processes events until ctx is done. In-flight events are not
+// interrupted by ctx, they are given up to the drain timeout to finish
+func (p *Processor) ListenAndProcess(ctx context.Context) error {
+	drainCtx, cancelDrain := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelDrain()
+
+	stopDrainTimer := context.AfterFunc(ctx, func() {
+		p.logger.Info("Shutdown requested, draining in-flight events", "timeout", p.drainTimeout)
+		time.AfterFunc(p.drainTimeout, cancelDrain)
+	})
+	defer stopDrainTimer()
+
+	return p.listener.Listen(ctx, func(e Event, channels []Channel) ([]Delivery, error) {
+		return p.publishEventToAllChannels(drainCtx, e, channels)
+	})
+}
+
+func (p *Processor) Close() error {
+	var errs []error
+	for key, publisher := range p.publishers {
+		if err := publisher.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close output [%s], got error %s", key, err.Error()))
+		}
+	}
+
+	for key, mapper := range p.mappers {
+		if err := mapper.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close mapper [%s], got error %s", key, err.Error()))
+		}
+	}
+
+	if err := p.listener.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close input, got error %s", err.Error()))
+	}
+
+	return errors.Join(errs...)
 }
 
-func (p *Processor) publishEventToAllChannels(e Event, channels []Channel) error {
+func (p *Processor) publishEventToAllChannels(ctx context.Context, e Event, channels []Channel) ([]Delivery, error) {
+	deliveries := make([]Delivery, len(channels))
+
+	p.ordering.startEvent(e)
+
 	var wg sync.WaitGroup
-	for _, channel := range channels {
+	for i, channel := range channels {
 		wg.Add(1)
 
 		p.logger.Debug("Publishing to channel", "event", e, "channel", channel.Key)
@@ -44,13 +91,44 @@ func (p *Processor) publishEventToAllChannels(e Event, channels []Channel) error
 		go func() {
 			defer wg.Done()
 
-			if err := p.publishEventOnChannel(e, channel); err != nil {
+			if heldBy, held := p.ordering.heldBy(channel, e); held {
+				p.logger.Debug("Event held to keep channel ordering", "event", e.ID, "channel", channel.Key, "heldBy", heldBy)
+
+				deliveries[i] = Delivery{
+					Channel: channel,
+					Status:  DeliveryStatusFailed,
+					Err: fmt.Errorf(
+						"event held until event %d is delivered, to keep the %s ordering of the channel",
+						heldBy,
+						channel.OrderingOrDefault()),
+				}
+				return
+			}
+
+			defer func() {
+				p.ordering.record(channel, e, deliveries[i].Done())
+			}()
+
+			payload, attempts, err := p.publishEventOnChannelWithRetry(ctx, e, channel)
+
+			deliveries[i] = Delivery{
+				Channel:  channel,
+				Status:   DeliveryStatusDelivered,
+				Attempts: attempts,
+			}
+
+			if err != nil {
 				p.logger.Error(
 					"Failed to process event for channel",
 					"event", e.ID,
 					"channel", channel.Key,
 					"error", err.Error(),
 				)
+
+				deliveries[i].Status = DeliveryStatusFailed
+				deliveries[i].Err = err
+
+				p.deadLetterIfEnabled(ctx, e, payload, &deliveries[i])
 				return
 			}
 
@@ -64,43 +142,158 @@ func (p *Processor) publishEventToAllChannels(e Event, channels []Channel) error
 
 	wg.Wait()
 
-	return nil
+	return deliveries, nil
 }
 
-func (p *Processor) publishEventOnChannel(e Event, channel Channel) error {
-	publisher, err := p.getPublisher(channel)
+func (p *Processor) publishEventOnChannelWithRetry(ctx context.Context, e Event, channel Channel) ([]byte, uint64, error) {
+	maxAttempts := channel.Retry.MaxAttemptsOrDefault()
+
+	for attempt := uint64(1); ; attempt++ {
+		payload, err := p.publishEventOnChannel(ctx, e, channel)
+		if err == nil {
+			return payload, attempt, nil
+		}
+
+		if attempt >= maxAttempts || !channel.Retry.IsRetryable(err) {
+			return payload, attempt, err
+		}
+
+		delay := channel.Retry.Delay(attempt)
+
+		p.logger.Warn(
+			"Failed to process event for channel, retrying",
+			"event", e.ID,
+			"channel", channel.Key,
+			"attempt", attempt,
+			"errorClass", ErrorClass(err),
+			"delay", delay,
+			"error", err.Error(),
+		)
+
+		select {
+		case <-ctx.Done():
+			return payload, attempt, errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Returns the mapped payload even when publishing fails, so it can be
+// included on the dead letter
+func (p *Processor) publishEventOnChannel(ctx context.Context, e Event, channel Channel) ([]byte, error) {
+	publisher, err := p.getPublisher(channel.To)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	payload, err := p.getPayload(e, channel)
+	payload, key, err := p.getPayloadAndKey(ctx, e, channel)
+	if err != nil {
+		return nil, &mapperError{err: err}
+	}
+
+	if err := publisher.Publish(ctx, e, key, payload); err != nil {
+		return payload, err
+	}
+
+	return payload, nil
+}
+
+func (p *Processor) deadLetterIfEnabled(ctx context.Context, e Event, payload []byte, delivery *Delivery) {
+	if !delivery.Channel.DeadLetter.Enabled() {
+		return
+	}
+
+	deadLetter := DeadLetter{
+		Event:    e,
+		Payload:  string(payload),
+		Channel:  delivery.Channel.Key,
+		Error:    delivery.Err.Error(),
+		Attempts: delivery.Attempts,
+	}
+
+	if err := p.publishDeadLetter(ctx, e, delivery.Channel.DeadLetter, deadLetter); err != nil {
+		p.logger.Error(
+			"Failed to dead letter event",
+			"event", e.ID,
+			"channel", delivery.Channel.Key,
+			"error", err.Error(),
+		)
+
+		delivery.Err = errors.Join(delivery.Err, err)
+		return
+	}
+
+	p.logger.Warn("Event dead lettered", "deadLetter", deadLetter)
+
+	delivery.Status = DeliveryStatusDeadLettered
+}
+
+func (p *Processor) publishDeadLetter(ctx context.Context, e Event, config DeadLetterConfig, deadLetter DeadLetter) error {
+	if config.Table {
+		writer, ok := p.listener.(DeadLetterWriter)
+		if !ok {
+			return errors.New("failed to dead letter event, input does not support a dead letter table")
+		}
+
+		return writer.WriteDeadLetter(ctx, deadLetter)
+	}
+
+	publisher, err := p.getPublisher(config.To)
 	if err != nil {
 		return err
 	}
 
-	if err := publisher.Publish(e, payload); err != nil {
+	payload, err := json.Marshal(deadLetter)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return publisher.Publish(ctx, e, []byte(strconv.FormatUint(e.ID, 10)), payload)
 }
 
-func (p *Processor) getPublisher(channel Channel) (Publisher, error) {
-	publisher, exists := p.publishers[channel.To]
+func (p *Processor) getPublisher(to string) (Publisher, error) {
+	publisher, exists := p.publishers[to]
 	if !exists {
 		return nil, fmt.Errorf(
 			"failed to publish event, publisher [%s] dont exists",
-			channel.To)
+			to)
 	}
 
 	return publisher, nil
 }
 
-func (p *Processor) getPayload(e Event, channel Channel) ([]byte, error) {
+// Mapper provided keys are returned by the same call that maps the payload,
+// so the mapper runs only once per event
+func (p *Processor) getPayloadAndKey(ctx context.Context, e Event, channel Channel) ([]byte, []byte, error) {
 	mapper, exists := p.mappers[channel.Mapper]
+
+	if channel.RecordKey.StrategyOrDefault() == RecordKeyMapper {
+		keyMapper, ok := mapper.(KeyMapper)
+		if !exists || !ok {
+			return nil, nil, fmt.Errorf(
+				"channel [%s] uses the mapper record key strategy, but mapper [%s] does not provide keys",
+				channel.Key,
+				channel.Mapper)
+		}
+
+		return keyMapper.MapWithKey(ctx, e)
+	}
+
+	var payload []byte
+	var err error
 	if exists {
-		return mapper.Map(e)
+		payload, err = mapper.Map(ctx, e)
+	} else {
+		payload, err = json.Marshal(e)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := channel.RecordKey.Key(e)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return json.Marshal(e)
+	return payload, key, nil
 }
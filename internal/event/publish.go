@@ -0,0 +1,124 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Publishes an event to the channels it is routed to, as handed to listeners
+// by the processor
+type Callback = func(event Event, channels []Channel) ([]Delivery, error)
+
+// Publishes the event once to the channels routed to it that are not in
+// delivered, returning their deliveries. Events without any pending channel
+// are skipped and return no deliveries
+func PublishPending(
+	e Event,
+	tableToChannelRelation map[string][]Channel,
+	delivered map[string]bool,
+	callback Callback,
+	logger *slog.Logger,
+) ([]Delivery, error) {
+	logger.Debug("Publishing event", "event", e)
+
+	channels, ok := ChannelsForEvent(tableToChannelRelation, e)
+	if !ok && e.Op == OpCommit {
+		logger.Debug("Transaction did not change any table with transaction markers, skipping", "id", e.ID)
+		return nil, nil
+	}
+
+	if !ok {
+		logger.Warn("Table does not have any configured channel, skipping", "id", e.ID, "table", e.QualifiedTable())
+		return nil, nil
+	}
+
+	pendingChannels := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !delivered[channel.Key] {
+			pendingChannels = append(pendingChannels, channel)
+		}
+	}
+
+	if len(pendingChannels) == 0 {
+		return nil, nil
+	}
+
+	logger.Debug("Calling publish event callback", "event", e, "channels", pendingChannels)
+
+	deliveries, err := callback(e, pendingChannels)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to publish event, got error %s", err.Error())
+	}
+
+	return deliveries, nil
+}
+
+// Adds the channels that acknowledged the event to delivered, returning the
+// ones that did not
+func MarkDelivered(deliveries []Delivery, delivered map[string]bool) []Channel {
+	var failedChannels []Channel
+	for _, delivery := range deliveries {
+		if delivery.Done() {
+			delivered[delivery.Channel.Key] = true
+		} else {
+			failedChannels = append(failedChannels, delivery.Channel)
+		}
+	}
+
+	return failedChannels
+}
+
+// Retries events in place, for inputs that can not move past an event before
+// it is acknowledged, such as replication streams
+type Retrier struct {
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	// Called before waiting for each retry, to keep connections alive while
+	// the event is retried (optional)
+	BeforeWait func(ctx context.Context) error
+}
+
+// Publishes the event until every channel routed to it has acknowledged,
+// retrying only the channels that failed. Returns the ctx error if ctx is done
+// while waiting to retry
+func (r Retrier) Publish(
+	ctx context.Context,
+	e Event,
+	tableToChannelRelation map[string][]Channel,
+	callback Callback,
+) error {
+	delivered := make(map[string]bool)
+	for {
+		deliveries, err := PublishPending(e, tableToChannelRelation, delivered, callback, r.Logger)
+		if err != nil {
+			return err
+		}
+
+		failedChannels := MarkDelivered(deliveries, delivered)
+		if len(failedChannels) == 0 {
+			return nil
+		}
+
+		r.Logger.Warn(
+			"Event was not acknowledged by every channel, retrying",
+			"event", e.ID,
+			"channels", len(failedChannels),
+			"retryInterval", r.Interval,
+		)
+
+		if r.BeforeWait != nil {
+			if err := r.BeforeWait(ctx); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.Interval):
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func channelKeys(channels []Channel) []string {
+	keys := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		keys = append(keys, channel.Key)
+	}
+
+	return keys
+}
+
+func TestPublishPending(t *testing.T) {
+	relation := TableToChannelRelation(map[string]Channel{
+		"a": {From: "sales", Key: "a"},
+	})
+
+	var published []string
+	callback := func(e Event, channels []Channel) ([]Delivery, error) {
+		published = append(published, channelKeys(channels)...)
+		return nil, nil
+	}
+
+	if _, err := PublishPending(Event{Table: "customers"}, relation, nil, callback, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PublishPending(Event{Table: "sales"}, relation, map[string]bool{"a": true}, callback, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+
+	if published != nil {
+		t.Errorf("events without pending channels should be skipped, published to %v", published)
+	}
+
+	_, err := PublishPending(Event{Table: "sales"}, relation, nil, func(Event, []Channel) ([]Delivery, error) {
+		return nil, errors.New("callback failed")
+	}, slog.Default())
+	if err == nil {
+		t.Error("PublishPending should return the callback error")
+	}
+}
+
+func TestRetrierPublish(t *testing.T) {
+	relation := TableToChannelRelation(map[string]Channel{
+		"a": {From: "sales", Key: "a"},
+		"b": {From: "sales", Key: "b"},
+	})
+
+	var calls [][]string
+	callback := func(e Event, channels []Channel) ([]Delivery, error) {
+		calls = append(calls, channelKeys(channels))
+
+		deliveries := make([]Delivery, 0, len(channels))
+		for _, channel := range channels {
+			status := DeliveryStatusDelivered
+			if channel.Key == "b" && len(calls) < 3 {
+				status = DeliveryStatusFailed
+			}
+
+			deliveries = append(deliveries, Delivery{Channel: channel, Status: status})
+		}
+
+		return deliveries, nil
+	}
+
+	waits := 0
+	retrier := Retrier{
+		Interval: time.Millisecond,
+		Logger:   slog.Default(),
+		BeforeWait: func(context.Context) error {
+			waits++
+			return nil
+		},
+	}
+
+	if err := retrier.Publish(context.Background(), Event{Table: "sales"}, relation, callback); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 3 || len(calls[0]) != 2 || !reflect.DeepEqual(calls[1:], [][]string{{"b"}, {"b"}}) {
+		t.Errorf("only the failed channel should be retried, got calls %v", calls)
+	}
+
+	if waits != 2 {
+		t.Errorf("BeforeWait should be called before each retry, got %d calls", waits)
+	}
+}
+
+func TestRetrierPublishStopsWithContext(t *testing.T) {
+	relation := TableToChannelRelation(map[string]Channel{
+		"a": {From: "sales", Key: "a"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	callback := func(e Event, channels []Channel) ([]Delivery, error) {
+		cancel()
+		return []Delivery{{Channel: channels[0], Status: DeliveryStatusFailed}}, nil
+	}
+
+	retrier := Retrier{Interval: time.Hour, Logger: slog.Default()}
+	if err := retrier.Publish(ctx, Event{Table: "sales"}, relation, callback); !errors.Is(err, context.Canceled) {
+		t.Errorf("Publish should return the ctx error, got %v", err)
+	}
+}
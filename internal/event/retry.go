@@ -0,0 +1,137 @@
+package event
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	ErrorClassTransient = "transient"
+	ErrorClassPermanent = "permanent"
+	ErrorClassMapper    = "mapper"
+)
+
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Marks an error as permanent, so it is not retried unless the channel
+// explicitly opts into retrying permanent errors
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+type mapperError struct {
+	err error
+}
+
+func (e *mapperError) Error() string {
+	return e.err.Error()
+}
+
+func (e *mapperError) Unwrap() error {
+	return e.err
+}
+
+func ErrorClass(err error) string {
+	var mapperErr *mapperError
+	if errors.As(err, &mapperErr) {
+		return ErrorClassMapper
+	}
+
+	if IsPermanent(err) {
+		return ErrorClassPermanent
+	}
+
+	return ErrorClassTransient
+}
+
+type RetryConfig struct {
+	MaxAttempts    uint64   `yaml:"maxAttempts"`
+	InitialDelayMs uint64   `yaml:"initialDelayMs"`
+	Multiplier     float64  `yaml:"multiplier"`
+	MaxDelayMs     uint64   `yaml:"maxDelayMs"`
+	Jitter         float64  `yaml:"jitter"`
+	RetryOn        []string `yaml:"retryOn"`
+}
+
+func (rc RetryConfig) MaxAttemptsOrDefault() uint64 {
+	if rc.MaxAttempts == 0 {
+		return 1
+	}
+
+	return rc.MaxAttempts
+}
+
+func (rc RetryConfig) InitialDelayOrDefault() time.Duration {
+	if rc.InitialDelayMs == 0 {
+		return 100 * time.Millisecond
+	}
+
+	return time.Duration(rc.InitialDelayMs) * time.Millisecond
+}
+
+func (rc RetryConfig) MultiplierOrDefault() float64 {
+	if rc.Multiplier < 1 {
+		return 2
+	}
+
+	return rc.Multiplier
+}
+
+func (rc RetryConfig) MaxDelayOrDefault() time.Duration {
+	if rc.MaxDelayMs == 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(rc.MaxDelayMs) * time.Millisecond
+}
+
+func (rc RetryConfig) JitterOrDefault() float64 {
+	return math.Min(math.Max(rc.Jitter, 0), 1)
+}
+
+func (rc RetryConfig) RetryOnOrDefault() []string {
+	if len(rc.RetryOn) == 0 {
+		return []string{ErrorClassTransient}
+	}
+
+	return rc.RetryOn
+}
+
+func (rc RetryConfig) IsRetryable(err error) bool {
+	return slices.Contains(rc.RetryOnOrDefault(), ErrorClass(err))
+}
+
+// Returns how long to wait before the next attempt, growing exponentially
+// from the initial delay up to the max delay, randomized by +/- jitter
+func (rc RetryConfig) Delay(attempt uint64) time.Duration {
+	delay := float64(rc.InitialDelayOrDefault()) * math.Pow(rc.MultiplierOrDefault(), float64(attempt-1))
+	delay = math.Min(delay, float64(rc.MaxDelayOrDefault()))
+
+	if jitter := rc.JitterOrDefault(); jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryConfigDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   RetryConfig
+		attempt  uint64
+		expected time.Duration
+	}{
+		{"defaults on the first attempt", RetryConfig{}, 1, 100 * time.Millisecond},
+		{"defaults grow exponentially", RetryConfig{}, 4, 800 * time.Millisecond},
+		{"custom multiplier", RetryConfig{InitialDelayMs: 10, Multiplier: 3}, 3, 90 * time.Millisecond},
+		{"multiplier below one uses the default", RetryConfig{InitialDelayMs: 10, Multiplier: 0.5}, 2, 20 * time.Millisecond},
+		{"capped by the max delay", RetryConfig{InitialDelayMs: 1000, MaxDelayMs: 5000}, 10, 5 * time.Second},
+		{"capped by the default max delay", RetryConfig{}, 64, 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if delay := test.config.Delay(test.attempt); delay != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, delay)
+			}
+		})
+	}
+}
+
+func TestRetryConfigDelayJitter(t *testing.T) {
+	config := RetryConfig{InitialDelayMs: 1000, Jitter: 0.2}
+
+	for range 100 {
+		delay := config.Delay(1)
+		if delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("expected a delay within 20%% of 1s, got %s", delay)
+		}
+	}
+
+	// Jitter is clamped to 100%, so the delay never goes negative
+	config.Jitter = 5
+	for range 100 {
+		if delay := config.Delay(1); delay < 0 || delay > 2*time.Second {
+			t.Fatalf("expected a delay between 0 and 2s, got %s", delay)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package event
+
+import (
+	"strings"
+)
+
+// Groups the channels by the table they read from
+func TableToChannelRelation(channels map[string]Channel) map[string][]Channel {
+	tableToChannelRelation := make(map[string][]Channel, len(channels))
+
+	for _, channel := range channels {
+		tableToChannelRelation[channel.From] = append(
+			tableToChannelRelation[channel.From],
+			channel,
+		)
+	}
+
+	return tableToChannelRelation
+}
+
+// Channels may be declared with either the schema qualified name or the bare
+// table name, the qualified name takes precedence
+func ChannelsForEvent(tableToChannelRelation map[string][]Channel, e Event) ([]Channel, bool) {
+	if e.Op == OpCommit {
+		channels := transactionMarkerChannels(tableToChannelRelation, e)
+		return channels, len(channels) > 0
+	}
+
+	if channels, ok := tableToChannelRelation[e.QualifiedTable()]; ok {
+		return channels, true
+	}
+
+	channels, ok := tableToChannelRelation[e.Table]
+	return channels, ok
+}
+
+func UsesTransactionMarkers(channels map[string]Channel) bool {
+	for _, channel := range channels {
+		if channel.TransactionMarkers {
+			return true
+		}
+	}
+
+	return false
+}
+
+func UsesDeadLetterTable(channels map[string]Channel) bool {
+	for _, channel := range channels {
+		if channel.DeadLetter.Table {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the channels that want the markers of the transaction, which are
+// the ones routed to any of the tables it changed
+func transactionMarkerChannels(tableToChannelRelation map[string][]Channel, e Event) []Channel {
+	tables, _ := e.Row["tables"].(map[string]any)
+
+	var channels []Channel
+	seen := make(map[string]bool)
+	for qualifiedTable := range tables {
+		schema, table, _ := strings.Cut(qualifiedTable, ".")
+		tableChannels, _ := ChannelsForEvent(tableToChannelRelation, Event{Schema: schema, Table: table})
+
+		for _, channel := range tableChannels {
+			if channel.TransactionMarkers && !seen[channel.Key] {
+				seen[channel.Key] = true
+				channels = append(channels, channel)
+			}
+		}
+	}
+
+	return channels
+}
+
+// Builds the commit marker of a transaction from the number of events each
+// table had on it
+func NewTransactionMarker(tableEvents map[string]uint64) map[string]any {
+	tables := make(map[string]any, len(tableEvents))
+	for table, events := range tableEvents {
+		tables[table] = float64(events)
+	}
+
+	return map[string]any{"tables": tables}
+}
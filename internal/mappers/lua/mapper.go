@@ -1,11 +1,13 @@
 package lua
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/cjoudrey/gluahttp"
 	"github.com/gustapinto/from-to/internal/event"
@@ -25,22 +27,31 @@ func NewMapper(config Config) (*Mapper, error) {
 	}, nil
 }
 
-func (m *Mapper) Map(e event.Event) ([]byte, error) {
+func (m *Mapper) Map(ctx context.Context, e event.Event) ([]byte, error) {
+	payload, _, err := m.MapWithKey(ctx, e)
+	return payload, err
+}
+
+// The function may return the record key as a second value, strings are used
+// as is and any other value is encoded as JSON
+func (m *Mapper) MapWithKey(ctx context.Context, e event.Event) ([]byte, []byte, error) {
 	l := lua.NewState()
 	defer l.Close()
 
+	l.SetContext(ctx)
+
 	l.PreloadModule("http", gluahttp.NewHttpModule(&http.Client{}).Loader)
 	l.PreloadModule("json", luajson.Loader)
 
 	if m.config.Source != nil {
 		if err := l.DoString(*m.config.Source); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		m.logger.Debug("Loaded lua inline definition")
 	} else {
 		if err := l.DoFile(m.config.FilePath); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		m.logger.Debug("Loaded lua file", "file", m.config.FilePath)
@@ -50,11 +61,11 @@ func (m *Mapper) Map(e event.Event) ([]byte, error) {
 
 	err := l.CallByParam(lua.P{
 		Fn:      l.GetGlobal(m.config.Function).(*lua.LFunction),
-		NRet:    1,
+		NRet:    2,
 		Protect: true,
 	}, eventTable)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	m.logger.Debug(
@@ -62,24 +73,47 @@ func (m *Mapper) Map(e event.Event) ([]byte, error) {
 		"function", m.config.FilePath,
 	)
 
-	result := m.toGoValue(l.Get(-1))
+	result := m.toGoValue(l.Get(-2))
 	resultMap, ok := result.(map[string]any)
 	if !ok {
-		return nil, errors.New("failed to convert mapped value back to Go")
+		return nil, nil, errors.New("failed to convert mapped value back to Go")
 	}
 
 	payload, err := json.Marshal(resultMap)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	key, err := m.toKey(l.Get(-1))
+	if err != nil {
+		return nil, nil, err
 	}
 
 	m.logger.Debug(
 		"Converted lua function return to payload",
 		"function", m.config.Function,
 		"payload", string(payload),
+		"key", string(key),
 	)
 
-	return payload, nil
+	return payload, key, nil
+}
+
+func (m *Mapper) toKey(luaValue lua.LValue) ([]byte, error) {
+	switch value := m.toGoValue(luaValue).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(value), nil
+	default:
+		return json.Marshal(value)
+	}
+}
+
+// Each mapping runs on its own Lua state, closed as soon as the mapping is
+// done, so there is nothing left to release here
+func (m *Mapper) Close() error {
+	return nil
 }
 
 func (m *Mapper) toGoValue(luaValue lua.LValue) any {
@@ -117,6 +151,10 @@ func (m *Mapper) toGoValue(luaValue lua.LValue) any {
 
 func (m *Mapper) toLuaValue(l *lua.LState, value any) lua.LValue {
 	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
 	case string:
 		return lua.LString(v)
 	case int:
@@ -135,11 +173,20 @@ func (m *Mapper) toLuaValue(l *lua.LState, value any) lua.LValue {
 
 		return table
 	case []any:
+		// Arrays of the row are indexed from 0, as existing mappers expect
 		list := l.NewTable()
 		for i, value := range v {
 			list.RawSet(lua.LNumber(i), m.toLuaValue(l, value))
 		}
 
+		return list
+	case []string:
+		// Column lists, like "changed", are regular 1 based Lua sequences
+		list := l.NewTable()
+		for i, value := range v {
+			list.RawSetInt(i+1, lua.LString(value))
+		}
+
 		return list
 	default:
 		return nil
@@ -152,7 +199,43 @@ func (m *Mapper) eventToLuaTable(l *lua.LState, e event.Event) lua.LValue {
 		"ts":    e.Ts,
 		"op":    e.Op,
 		"table": e.Table,
-		"row":   e.Row,
+	}
+
+	if e.Row != nil {
+		eventMap["row"] = e.Row
+	}
+
+	if e.Schema != "" {
+		eventMap["schema"] = e.Schema
+	}
+
+	if !e.Timestamp.IsZero() {
+		eventMap["timestamp"] = e.Timestamp.Format(time.RFC3339Nano)
+	}
+
+	if e.TxID != 0 {
+		eventMap["txid"] = e.TxID
+		eventMap["txseq"] = e.TxSeq
+	}
+
+	if e.Key != nil {
+		eventMap["key"] = e.Key
+	}
+
+	if e.Before != nil {
+		eventMap["before"] = e.Before
+	}
+
+	if e.Changed != nil {
+		eventMap["changed"] = e.Changed
+	}
+
+	if e.Unchanged != nil {
+		eventMap["unchanged"] = e.Unchanged
+	}
+
+	if e.Headers != nil {
+		eventMap["headers"] = e.Headers
 	}
 
 	return m.toLuaValue(l, eventMap)